@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AdjustedRequest selects the daily series to correct for day-of-week reporting effects
+type AdjustedRequest struct {
+	LocationKey string `json:"location_key"`          // Required
+	Metric      string `json:"metric"`                // Required: a new_* metric column
+	StartDate   string `json:"start_date"`            // Required
+	EndDate     string `json:"end_date"`              // Required
+	HistoryDays int    `json:"history_days"`          // Optional: days before start_date also used to estimate the factors, default 84
+	AsOf        string `json:"as_of,omitempty"`       // Optional: see /api/timeseries
+	Dedupe      *bool  `json:"dedupe,omitempty"`      // Optional: see /api/timeseries
+	DateFormat  string `json:"date_format,omitempty"` // Optional: see /api/timeseries
+}
+
+// AdjustedPoint is one day's reported value next to its adjusted estimate
+type AdjustedPoint struct {
+	Date     Date    `json:"date"`
+	Value    int32   `json:"value"`
+	Adjusted float64 `json:"adjusted"`
+	Factor   float64 `json:"factor"`
+	Holiday  bool    `json:"holiday,omitempty"`
+}
+
+// AdjustedResponse is the adjusted series with the weekday factors it used
+type AdjustedResponse struct {
+	LocationKey string             `json:"location_key"`
+	Metric      string             `json:"metric"`
+	Factors     map[string]float64 `json:"factors"` // weekday → reporting factor, averaging 1
+	Samples     int                `json:"samples"` // days the factors were estimated from
+	Series      []AdjustedPoint    `json:"series"`
+}
+
+// validate checks the location, metric, range and history length
+func (r AdjustedRequest) validate() error {
+	if r.LocationKey == "" {
+		return errors.New("location_key is required")
+	}
+	// Cumulative columns have no reporting rhythm to correct
+	if !isMetricColumn(r.Metric) || !strings.HasPrefix(r.Metric, "new_") {
+		return fmt.Errorf("metric must be one of the new_* columns, got %q", r.Metric)
+	}
+	if _, _, err := parseDateRange("start_date", r.StartDate, "end_date", r.EndDate); err != nil {
+		return err
+	}
+	if r.HistoryDays < 0 || r.HistoryDays > 365 {
+		return errors.New("history_days must be between 0 and 365")
+	}
+	return nil
+}
+
+// getAdjusted handles POST /api/adjusted.
+//
+// Method: every day d whose centred week d-3..d+3 is fully reported gets the ratio of its
+// value to that week's mean. A weekday's factor is the mean ratio of its days (1 with
+// fewer than two samples), and the seven factors are rescaled to average 1 so a week's
+// adjusted total stays close to its reported total. Each day is then returned as
+// value / factor. Holidays (STALENESS_HOLIDAYS) are left out of the estimate and adjusted
+// with Sunday's factor, assuming they are reported like a Sunday. The factors come from
+// the requested range plus history_days before it, and assume the weekly pattern is
+// stable over that period.
+func getAdjusted(c *fiber.Ctx) error {
+	req := AdjustedRequest{HistoryDays: 84}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid filter parameters"})
+	}
+	if err := req.validate(); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	format, err := resolveDateFormat(c, req.DateFormat)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	filter := FilterRequest{LocationKey: req.LocationKey, AsOf: req.AsOf, Dedupe: req.Dedupe}
+	reads, readArgs, err := filter.readConditions(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	start, end, _ := parseDateRange("start_date", req.StartDate, "end_date", req.EndDate)
+	recordUsageFilter(c, []interface{}{req.LocationKey}, req.StartDate, req.EndDate)
+	clampDateRange(c, req.StartDate, req.EndDate)
+
+	// The centred week of the last days reaches past end_date
+	from, to := start.AddDate(0, 0, -req.HistoryDays), end.AddDate(0, 0, 3)
+	conditions := append([]string{"location_key = ?", "date BETWEEN ? AND ?"}, reads...)
+	args := append([]interface{}{req.LocationKey, from.Format(time.DateOnly), to.Format(time.DateOnly)}, readArgs...)
+	query := `
+	SELECT date, ` + req.Metric + `
+	FROM ` + readSource(conditions, filter.dedupe()) + `
+	ORDER BY date`
+
+	rows, err := db.Query(c.UserContext(), query, args...)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Query execution failed: " + err.Error()})
+	}
+	defer rows.Close()
+
+	values := map[time.Time]int32{}
+	for rows.Next() {
+		var date time.Time
+		var value int32
+		if err := rows.Scan(&date, &value); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Row scan failed: " + err.Error()})
+		}
+		values[date.UTC()] = value
+	}
+
+	if err := rows.Err(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading rows"})
+	}
+
+	holidays := map[time.Time]bool{}
+	for _, day := range cfg.StalenessHolidays {
+		if t, err := time.Parse(time.DateOnly, day); err == nil {
+			holidays[t] = true
+		}
+	}
+	factors, samples := weekdayFactors(values, holidays)
+
+	result := AdjustedResponse{LocationKey: req.LocationKey, Metric: req.Metric, Factors: map[string]float64{}, Samples: samples, Series: []AdjustedPoint{}}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		result.Factors[strings.ToLower(day.String())] = round(factors[day])
+	}
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		value, ok := values[d]
+		if !ok {
+			continue
+		}
+		factor := factors[d.Weekday()]
+		if holidays[d] {
+			factor = factors[time.Sunday]
+		}
+		point := AdjustedPoint{Date: Date{Time: d, format: format}, Value: value, Factor: round(factor), Holiday: holidays[d]}
+		point.Adjusted = float64(value)
+		if factor > 0 {
+			point.Adjusted = round(float64(value) / factor)
+		}
+		result.Series = append(result.Series, point)
+	}
+
+	return respond(c, result)
+}
+
+// weekdayFactors estimates each weekday's reporting factor from the ratio of a day's value
+// to the mean of its centred week, rescaled so the seven factors average 1
+func weekdayFactors(values map[time.Time]int32, holidays map[time.Time]bool) ([7]float64, int) {
+	var sums [7]float64
+	var counts [7]int
+	samples := 0
+	for d, value := range values {
+		if holidays[d] {
+			continue
+		}
+		week, complete := 0.0, true
+		for offset := -3; offset <= 3 && complete; offset++ {
+			v, ok := values[d.AddDate(0, 0, offset)]
+			week += float64(v)
+			complete = ok
+		}
+		if !complete || week <= 0 {
+			continue
+		}
+		sums[d.Weekday()] += float64(value) / (week / 7)
+		counts[d.Weekday()]++
+		samples++
+	}
+
+	var factors [7]float64
+	total := 0.0
+	for day := range factors {
+		factors[day] = 1
+		if counts[day] >= 2 {
+			factors[day] = sums[day] / float64(counts[day])
+		}
+		total += factors[day]
+	}
+	if total > 0 {
+		for day := range factors {
+			factors[day] *= 7 / total
+		}
+	}
+	return factors, samples
+}
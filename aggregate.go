@@ -0,0 +1,291 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AggregateRequest sums a daily metric per location over an optional date range
+type AggregateRequest struct {
+	FilterRequest
+	Metric    string `json:"metric"`     // Required: a new_* metric column to sum
+	Limit     int    `json:"limit"`      // Optional: keep only the top N locations
+	PerCapita bool   `json:"per_capita"` // Optional: add population and total per 100,000 people
+}
+
+// AggregateData is one location's total with its share of the grand total
+type AggregateData struct {
+	LocationKey    string    `json:"location_key"`
+	Total          int64     `json:"total"`
+	PercentOfTotal *float64  `json:"percent_of_total"`     // null when the grand total is zero
+	Population     *uint64   `json:"population,omitempty"` // Set with per_capita; 0 when unknown
+	Per100k        **float64 `json:"per_100k,omitempty"`   // Set with per_capita; null for zero or unknown population
+}
+
+// validate checks the metric, date range and limit
+func (r AggregateRequest) validate() error {
+	// Cumulative columns are running totals; summing them across days is meaningless
+	if !isMetricColumn(r.Metric) || !strings.HasPrefix(r.Metric, "new_") {
+		return fmt.Errorf("metric must be one of the new_* columns, got %q", r.Metric)
+	}
+	if r.StartDate != "" || r.EndDate != "" {
+		if _, _, err := parseDateRange("start_date", r.StartDate, "end_date", r.EndDate); err != nil {
+			return err
+		}
+	}
+	if r.Limit < 0 {
+		return fmt.Errorf("limit must not be negative")
+	}
+	return nil
+}
+
+// getAggregate handles POST /api/aggregate, returning locations ordered by their total
+// for the metric. The grand total is taken over every matching location before the
+// limit is applied, so percent_of_total stays comparable with and without a limit.
+func getAggregate(c *fiber.Ctx) error {
+	var req AggregateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid filter parameters"})
+	}
+	if err := req.validate(); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	keys, err := req.locationKeys()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	recordUsageFilter(c, keys, req.StartDate, req.EndDate)
+	clampDateRange(c, req.StartDate, req.EndDate)
+
+	var conditions []string
+	var args []interface{}
+	if len(keys) > 0 {
+		condition, arg := locationCondition(keys)
+		conditions = append(conditions, condition)
+		args = append(args, arg)
+	}
+	if req.StartDate != "" {
+		conditions = append(conditions, "date BETWEEN ? AND ?")
+		args = append(args, req.StartDate, req.EndDate)
+	}
+	reads, readArgs, err := req.readConditions(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	conditions = append(conditions, reads...)
+	args = append(args, readArgs...)
+	if req.PerCapita && cfg.PerCapitaZeroPopulation == perCapitaExclude {
+		// Excluded before aggregating, so grand_total and the group count match the rows
+		conditions = append(conditions, fmt.Sprintf(withPopulation, populationSource()))
+	}
+
+	query := `
+	SELECT location_key,
+		   sum(` + req.Metric + `) AS total,
+		   sum(sum(` + req.Metric + `)) OVER () AS grand_total,
+		   count() OVER () AS groups
+	FROM ` + readSource(conditions, req.dedupe()) + `
+	GROUP BY location_key`
+	if req.PerCapita {
+		query = `
+	SELECT location_key, total, grand_total, groups, toUInt64(if(p.population > 0, p.population, 0)) AS population
+	FROM (` + query + `
+	) AS a
+	LEFT JOIN ` + populationSource() + ` AS p USING (location_key)`
+	}
+	query += "\n\tORDER BY total DESC, location_key"
+	// MAX_AGGREGATE_GROUPS bounds the response no matter what limit asks for
+	limit, capped := req.Limit, false
+	if cfg.MaxAggregateGroups > 0 && (limit == 0 || limit > cfg.MaxAggregateGroups) {
+		limit, capped = cfg.MaxAggregateGroups, true
+	}
+	if limit > 0 {
+		query += fmt.Sprintf("\n\tLIMIT %d", limit)
+	}
+
+	rows, err := db.Query(c.UserContext(), query, args...)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Query execution failed: " + err.Error()})
+	}
+	defer rows.Close()
+
+	data := []AggregateData{}
+	var grandTotal int64
+	var groups uint64
+	for rows.Next() {
+		var a AggregateData
+		dest := []interface{}{&a.LocationKey, &a.Total, &grandTotal, &groups}
+		if req.PerCapita {
+			a.Population = new(uint64)
+			dest = append(dest, a.Population)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Row scan failed: " + err.Error()})
+		}
+		if req.PerCapita {
+			a.Per100k = per100k(a.Total, *a.Population)
+		}
+		if grandTotal != 0 {
+			percent := round(float64(a.Total) / float64(grandTotal) * 100)
+			a.PercentOfTotal = &percent
+		}
+		data = append(data, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading rows"})
+	}
+
+	// Only a cap the caller did not ask for counts as overflow; an explicit smaller limit
+	// is a normal top-N request
+	if capped && groups > uint64(limit) {
+		if cfg.RejectAggregateOverflow {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("too many groups: %d (maximum %d); narrow the filters or set limit", groups, cfg.MaxAggregateGroups),
+			})
+		}
+		addMeta(c, "truncated", true)
+		addMeta(c, "total_groups", groups)
+		addWarning(c, fmt.Sprintf("result truncated to %d of %d groups", limit, groups))
+	}
+
+	if req.PerCapita {
+		warnDuplicateKeys(c, cfg.PopulationTable)
+	}
+	addMeta(c, "grand_total", grandTotal)
+	return respond(c, data)
+}
+
+// AggregateSeriesRequest sums the series of the locations at one level of the key
+// hierarchy, or of the listed locations, per date
+type AggregateSeriesRequest struct {
+	FilterRequest
+	Prefix string `json:"prefix"` // Optional: sum the locations under this key instead of the whole world
+	Level  *int   `json:"level"`  // Optional: hierarchy level summed; default 0 (countries), or the prefix's children
+}
+
+// AggregateSeriesData is the summed metrics of one day
+type AggregateSeriesData struct {
+	Date      Date             `json:"date"`
+	Locations uint64           `json:"locations"` // summed locations with a row that day
+	Values    map[string]int64 `json:"values"`
+}
+
+// scope returns the predicate selecting the summed locations. Explicit location keys
+// are summed as given; otherwise one level of the hierarchy is, so that a country is
+// never added to its own subregions.
+func (r AggregateSeriesRequest) scope() (string, []interface{}, error) {
+	keys, err := r.locationKeys()
+	if err != nil {
+		return "", nil, err
+	}
+	if len(keys) > 0 {
+		if r.Prefix != "" || r.Level != nil {
+			return "", nil, errors.New("prefix and level cannot be combined with location_key(s)")
+		}
+		condition, arg := locationCondition(keys)
+		return condition, []interface{}{arg}, nil
+	}
+	level := 0
+	if r.Prefix != "" {
+		level = strings.Count(r.Prefix, locationKeySeparator) + 1
+	}
+	if r.Level != nil {
+		level = *r.Level
+	}
+	if level < 0 || level >= len(locationKeyLevels) {
+		return "", nil, fmt.Errorf("level must be between 0 and %d", len(locationKeyLevels)-1)
+	}
+	if r.Prefix == "" {
+		return locationLevel + " = ?", []interface{}{level}, nil
+	}
+	if level <= strings.Count(r.Prefix, locationKeySeparator) {
+		return "", nil, fmt.Errorf("level must be below the prefix's own level")
+	}
+	return "startsWith(location_key, ?) AND " + locationLevel + " = ?", []interface{}{r.Prefix + locationKeySeparator, level}, nil
+}
+
+// getAggregateSeries handles POST /api/aggregate/series: one row per date with each
+// metric summed across the selected locations on that date. Cumulative columns are summed
+// across locations only, never across dates, so they stay running totals; on a date some
+// location did not report, its total is missing from the sum (see locations).
+func getAggregateSeries(c *fiber.Ctx) error {
+	var req AggregateSeriesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid filter parameters"})
+	}
+	if req.StartDate != "" || req.EndDate != "" {
+		if _, _, err := parseDateRange("start_date", req.StartDate, "end_date", req.EndDate); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	scope, args, err := req.scope()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	columns, err := resolveFields(req.Fields)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	format, err := resolveDateFormat(c, req.DateFormat)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	reads, readArgs, err := req.readConditions(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	keys, _ := req.locationKeys()
+	recordUsageFilter(c, keys, req.StartDate, req.EndDate)
+	clampDateRange(c, req.StartDate, req.EndDate)
+
+	conditions := []string{scope}
+	if req.StartDate != "" {
+		conditions = append(conditions, "date BETWEEN ? AND ?")
+		args = append(args, req.StartDate, req.EndDate)
+	}
+	conditions = append(conditions, reads...)
+	args = append(args, readArgs...)
+	sums := make([]string, len(columns))
+	for i, column := range columns {
+		sums[i] = "sum(" + column + ") AS " + column
+	}
+	query := `
+	SELECT date, uniqExact(location_key) AS locations, ` + join(sums, ", ") + `
+	FROM ` + readSource(conditions, req.dedupe()) + `
+	GROUP BY date
+	ORDER BY date`
+
+	rows, err := db.Query(c.UserContext(), query, args...)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Query execution failed: " + err.Error()})
+	}
+	defer rows.Close()
+
+	data := []AggregateSeriesData{}
+	for rows.Next() {
+		s := AggregateSeriesData{Date: Date{format: format}, Values: make(map[string]int64, len(columns))}
+		values := make([]int64, len(columns))
+		dest := []interface{}{&s.Date.Time, &s.Locations}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Row scan failed: " + err.Error()})
+		}
+		for i, column := range columns {
+			s.Values[column] = values[i]
+		}
+		data = append(data, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading rows"})
+	}
+
+	return respond(c, data)
+}
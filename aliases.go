@@ -0,0 +1,142 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// metricAlias is another name clients may use for a metric column, see METRIC_ALIASES
+type metricAlias struct {
+	Alias  string
+	Column string
+}
+
+// aliasedMembers are the request members whose values name metrics: a string, an array of
+// strings, or an object keyed by metric (PATCH fields)
+var aliasedMembers = map[string]bool{"metric": true, "top_metric": true, "fields": true}
+
+// normalizeMetricAliases parses METRIC_ALIASES ("alias=column" entries). An entry is
+// dropped when its column is not a metric column, or its alias already names a column,
+// computed field or earlier alias, since either would make a name ambiguous.
+func normalizeMetricAliases(entries []string) []metricAlias {
+	var aliases []metricAlias
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		alias, column, ok := strings.Cut(entry, "=")
+		alias, column = strings.TrimSpace(alias), strings.TrimSpace(column)
+		if !ok || alias == "" || !isMetricColumn(column) {
+			log.Printf("ignoring invalid METRIC_ALIASES entry %q", entry)
+			continue
+		}
+		if seen[alias] || isMetricColumn(alias) || containsString(keyColumns, alias) || containsString(computedFields, alias) {
+			log.Printf("ignoring METRIC_ALIASES entry %q: %q is already a field name", entry, alias)
+			continue
+		}
+		seen[alias] = true
+		aliases = append(aliases, metricAlias{Alias: alias, Column: column})
+	}
+	return aliases
+}
+
+// aliasColumns maps every alias to its column, for translating requests
+func aliasColumns() map[string]string {
+	columns := make(map[string]string, len(cfg.MetricAliases))
+	for _, a := range cfg.MetricAliases {
+		columns[a.Alias] = a.Column
+	}
+	return columns
+}
+
+// columnAliases maps each aliased column to its first alias, for translating responses
+func columnAliases() map[string]string {
+	aliases := make(map[string]string, len(cfg.MetricAliases))
+	for _, a := range cfg.MetricAliases {
+		if _, ok := aliases[a.Column]; !ok {
+			aliases[a.Column] = a.Alias
+		}
+	}
+	return aliases
+}
+
+// translateMetricAliases rewrites the metric names of a JSON or form-encoded request body
+// from their METRIC_ALIASES alias to the column, so handlers only ever see canonical names.
+// A body that is not valid JSON is left alone for the handler to reject.
+func translateMetricAliases(c *fiber.Ctx) error {
+	if len(cfg.MetricAliases) == 0 || len(c.Body()) == 0 {
+		return c.Next()
+	}
+	switch contentType := c.Get(fiber.HeaderContentType); {
+	case strings.HasPrefix(contentType, fiber.MIMEApplicationJSON):
+		rewrite := jsonRewrite{values: aliasColumns(), valueMembers: aliasedMembers}
+		if body, err := rewrite.apply(c.Body()); err == nil {
+			c.Request().SetBody(body)
+		}
+	case strings.HasPrefix(contentType, fiber.MIMEApplicationForm):
+		translateFormAliases(c)
+	}
+	return c.Next()
+}
+
+// translateFormAliases renames aliases in the values of the form fields naming metrics.
+// Form keys match struct fields case-insensitively, so "top_metric", "TopMetric" and
+// "fields[]" are all recognised.
+func translateFormAliases(c *fiber.Ctx) {
+	columns := aliasColumns()
+	args := c.Request().PostArgs()
+	type formField struct{ key, value string }
+	var fields []formField
+	changed := false
+	args.VisitAll(func(key, value []byte) {
+		field := formField{key: string(key), value: string(value)}
+		if column, ok := columns[field.value]; ok && isAliasedFormKey(field.key) {
+			field.value, changed = column, true
+		}
+		fields = append(fields, field)
+	})
+	if !changed {
+		return
+	}
+	// The parsed arguments are what BodyParser reads; the body is kept in step for logging
+	args.Reset()
+	for _, field := range fields {
+		args.Add(field.key, field.value)
+	}
+	c.Request().SetBody(args.QueryString())
+}
+
+// isAliasedFormKey reports whether a form key names one of the aliasedMembers
+func isAliasedFormKey(key string) bool {
+	name, _, _ := strings.Cut(key, "[")
+	name = strings.ToLower(strings.ReplaceAll(name, "_", ""))
+	for member := range aliasedMembers {
+		if name == strings.ReplaceAll(member, "_", "") {
+			return true
+		}
+	}
+	return false
+}
+
+// aliasedNames returns columns named as the response names them: by their first alias
+// when responseAliases is on, otherwise unchanged. It names CSV and HTML table headers.
+func aliasedNames(c *fiber.Ctx, columns []string) []string {
+	if !responseAliases(c) {
+		return columns
+	}
+	aliases := columnAliases()
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		if alias, ok := aliases[column]; ok {
+			column = alias
+		}
+		names[i] = column
+	}
+	return names
+}
+
+// responseAliases reports whether the response renames metrics to their aliases:
+// ?metric_aliases=true, defaulting to METRIC_ALIASES_IN_RESPONSES
+func responseAliases(c *fiber.Ctx) bool {
+	return len(cfg.MetricAliases) > 0 && c.QueryBool("metric_aliases", cfg.MetricAliasesInResponses)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// useAliases configures METRIC_ALIASES for the duration of the test
+func useAliases(t *testing.T) {
+	t.Helper()
+	old := cfg.MetricAliases
+	cfg.MetricAliases = normalizeMetricAliases([]string{"cases=new_confirmed", "deaths=new_deceased"})
+	t.Cleanup(func() { cfg.MetricAliases = old })
+}
+
+func TestTranslateFormAliases(t *testing.T) {
+	useAliases(t)
+	var got AggregateRequest
+	var topMetric string
+	var fields []string
+	app := fiber.New()
+	app.Post("/", translateMetricAliases, func(c *fiber.Ctx) error {
+		var filter FilterRequest
+		if err := c.BodyParser(&filter); err != nil {
+			return err
+		}
+		topMetric, fields = filter.TopMetric, filter.Fields
+		return c.BodyParser(&got)
+	})
+	body := "metric=cases&TopMetric=deaths&fields=cases&fields=new_tested&LocationKey=cases"
+	req := httptest.NewRequest(fiber.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationForm)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	if got.Metric != "new_confirmed" || topMetric != "new_deceased" || strings.Join(fields, ",") != "new_confirmed,new_tested" {
+		t.Errorf("metric %q, top_metric %q, fields %v; want the columns", got.Metric, topMetric, fields)
+	}
+	// Values of other fields are not metric names, even when they match an alias
+	if got.LocationKey != "cases" {
+		t.Errorf("location_key = %q, want it unchanged", got.LocationKey)
+	}
+}
+
+func TestIsAliasedFormKey(t *testing.T) {
+	for key, want := range map[string]bool{
+		"metric": true, "top_metric": true, "TopMetric": true, "fields": true, "fields[]": true,
+		"location_key": false, "format": false,
+	} {
+		if got := isAliasedFormKey(key); got != want {
+			t.Errorf("isAliasedFormKey(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestAliasedHeaders(t *testing.T) {
+	useAliases(t)
+	assumeTableNotEmpty(t)
+	columns := []string{"location_key", "date", "new_confirmed", "new_tested"}
+	app := fiber.New()
+	var names []string
+	app.Get("/", func(c *fiber.Ctx) error {
+		names = aliasedNames(c, columns)
+		return respond(c, []LocationName{})
+	})
+	app.Get("/html", func(c *fiber.Ctx) error {
+		confirmed := int32(5)
+		return respond(c, []TimeSeriesData{{LocationKey: "US", NewConfirmed: &confirmed}})
+	})
+
+	for query, want := range map[string]string{
+		"":                     "location_key,date,new_confirmed,new_tested",
+		"?metric_aliases=true": "location_key,date,cases,new_tested",
+	} {
+		if _, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/"+query, nil)); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(names, ","); got != want {
+			t.Errorf("CSV header %s = %s, want %s", query, got, want)
+		}
+
+		req := httptest.NewRequest(fiber.MethodGet, "/html"+query, nil)
+		req.Header.Set(fiber.HeaderAccept, fiber.MIMETextHTML)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		page, _ := io.ReadAll(resp.Body)
+		header := "<th>new_confirmed</th>"
+		if query != "" {
+			header = "<th>cases</th>"
+		}
+		if !strings.Contains(string(page), header) {
+			t.Errorf("HTML table %s lacks %s:\n%s", query, header, page)
+		}
+	}
+}
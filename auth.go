@@ -0,0 +1,33 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// requireAdmin rejects requests that do not carry the ADMIN_API_KEY as a bearer token.
+// Admin routes are disabled entirely when no key is configured.
+func requireAdmin(c *fiber.Ctx) error {
+	if cfg.AdminAPIKey == "" {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Admin endpoints are disabled"})
+	}
+	token := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AdminAPIKey)) != 1 {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid admin credentials"})
+	}
+	return c.Next()
+}
+
+// limitBody rejects request bodies larger than limit bytes. The server-wide limit is
+// sized for ingest, so regular API routes apply this tighter bound.
+func limitBody(limit int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if len(c.Body()) > limit {
+			return c.Status(http.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": "Request body too large"})
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// defaultCacheMaxAge is the Cache-Control max-age of each route; 0 means no-cache (revalidate)
+// and a negative value no-store. Routes not listed get no Cache-Control header.
+var defaultCacheMaxAge = map[string]time.Duration{
+	"/api/routes":           24 * time.Hour,
+	"/api/location-keys":    24 * time.Hour,
+	"/api/timeseries":       5 * time.Minute,
+	"/api/excess":           5 * time.Minute,
+	"/api/aggregate":        5 * time.Minute,
+	"/api/aggregate/series": 5 * time.Minute,
+	"/api/forecast":         time.Hour,
+	"/api/revisions":        5 * time.Minute,
+	"/api/weekly-trend":     time.Hour,
+	"/api/growth-factor":    time.Hour,
+	"/api/correlation":      time.Hour,
+	"/api/groups":           5 * time.Minute,
+	"/api/continents":       5 * time.Minute,
+	"/api/rank":             5 * time.Minute,
+	"/api/movers":           5 * time.Minute,
+	"/api/adjusted":         time.Hour,
+	"/api/milestones":       time.Hour,
+	"/api/sparklines":       5 * time.Minute,
+	"/api/testing-coverage": time.Hour,
+	"/api/reporting-lag":    time.Hour,
+	"/api/integrity-check":  -1,
+	"/api/stale-locations":  5 * time.Minute,
+	"/api/sla":              5 * time.Minute,
+	"/api/admin/*":          -1,
+}
+
+// cacheMaxAge applies CACHE_MAX_AGE overrides ("path=duration" entries) to the defaults
+func cacheMaxAge(overrides []string) map[string]time.Duration {
+	return routeDurations("CACHE_MAX_AGE", defaultCacheMaxAge, overrides)
+}
+
+// cacheHeaders sets Cache-Control on successful responses from the route's entry in
+// CACHE_MAX_AGE. Error responses are never cached. Responses depend on the negotiated
+// schema version and on Accept (HTML tables), so caches are told to vary on them.
+func cacheHeaders(c *fiber.Ctx) error {
+	err := c.Next()
+
+	status := c.Response().StatusCode()
+	if c.GetRespHeader(fiber.HeaderCacheControl) != "" {
+		return err
+	}
+	if status < 200 || status >= 300 {
+		c.Set(fiber.HeaderCacheControl, "no-store")
+		return err
+	}
+	maxAge, ok := routeMaxAge(c.Route().Path)
+	if !ok {
+		return err
+	}
+	switch {
+	case maxAge < 0:
+		c.Set(fiber.HeaderCacheControl, "no-store")
+	case maxAge == 0:
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+	default:
+		c.Set(fiber.HeaderCacheControl, "public, max-age="+strconv.Itoa(int(maxAge.Seconds())))
+	}
+	c.Vary(schemaVersionHeader, fiber.HeaderAccept)
+	return err
+}
+
+// routeMaxAge looks up the CACHE_MAX_AGE entry of path
+func routeMaxAge(path string) (time.Duration, bool) {
+	return routeDuration(cfg.CacheMaxAge, path)
+}
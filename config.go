@@ -0,0 +1,218 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the runtime settings read from the environment (or a .env file)
+type Config struct {
+	Debug                    bool                     // Enables debugging aids such as dry_run
+	UsePrewhere              bool                     // Emits location predicates as PREWHERE instead of WHERE
+	MaxLocationKeys          int                      // Upper bound on location_keys accepted in a single request
+	AdminAPIKey              string                   // Bearer token for /api/admin routes; admin routes are disabled when empty
+	BodyLimit                int                      // Maximum request body size in bytes for regular API routes
+	IngestBodyLimit          int                      // Maximum request body size in bytes for ingest routes
+	IngestBatchSize          int                      // Rows per INSERT batch when ingesting
+	ConsistencyChecks        []string                 // Names of the consistency checks to run; all when empty
+	ConsistencyInterval      time.Duration            // Interval between scheduled consistency runs; 0 disables the schedule
+	ConsistencyTolerance     int                      // Allowed difference between daily values and cumulative deltas
+	UpdatedAtColumn          string                   // covid19 column recording when a row was last ingested or updated
+	DefaultSchemaVersion     int                      // Response schema version served when the request does not ask for one
+	DedupeReads              bool                     // Collapses duplicate (location_key, date) rows at query time unless a request overrides it
+	MaxTopK                  int                      // Largest top_k accepted
+	PingInterval             time.Duration            // Interval between ClickHouse keep-alive pings; 0 disables them
+	PingTimeout              time.Duration            // Time a single keep-alive ping may take
+	UsageLogging             bool                     // Records API usage to the api_usage table
+	UsageBufferSize          int                      // Usage records buffered between flushes; further records are dropped
+	UsageFlushInterval       time.Duration            // Interval between usage flushes
+	UsageStoreIPs            bool                     // Stores client IPs with usage records
+	UsageStoreBodies         bool                     // Stores request bodies with usage records
+	MaxForecastHorizon       int                      // Largest forecast horizon in days
+	TestedUnit               string                   // What new_tested counts: "tests" performed or "people" tested
+	IntegrityCheckTimeout    time.Duration            // Time budget of each check run by /api/integrity-check
+	IntegritySampleSize      int                      // Offending rows returned per integrity check
+	FloatPrecision           int                      // Decimal places kept in computed float fields; negative disables rounding
+	StalenessCadence         string                   // Expected update cadence: daily, weekdays or weekly
+	StalenessGraceDays       int                      // Days an expected report may be late before a location counts as stale
+	StalenessHolidays        []string                 // Dates (YYYY-MM-DD) on which no report is expected
+	LocationKeysConflict     string                   // merge, location_key, location_keys or reject when a request names both
+	MaxAggregateGroups       int                      // cap on groups returned by group-by endpoints
+	RejectAggregateOverflow  bool                     // answer 400 instead of truncating when the cap is hit
+	QueryTimeout             time.Duration            // deadline for the queries of an /api request without a QUERY_TIMEOUTS entry; 0 disables
+	QueryTimeouts            map[string]time.Duration // query deadline per route
+	QueryTimeoutStatus       int                      // status answered when a query times out: 504 or 503
+	QueryTimeoutRetryAfter   time.Duration            // Retry-After sent with a 503 timeout
+	CacheMaxAge              map[string]time.Duration // Cache-Control max-age per route
+	APIKeyQuotas             map[string]quota         // request quotas per API key, keyed by consumer id
+	DefaultDailyQuota        int                      // daily requests per client IP without a listed API key; 0 is unlimited
+	DefaultMonthlyQuota      int                      // monthly requests per client IP without a listed API key; 0 is unlimited
+	MaxCorrelationLocations  int                      // most locations /api/correlation accepts
+	LatestRowStrategy        string                   // limit_by or window: how the latest row per location is selected
+	DefaultFields            []string                 // metric columns returned when a request names no fields
+	MaxHTMLRows              int                      // most rows one page of HTML output renders
+	Monotonicity             string                   // default check of decreasing cumulative values: off, flag or exclude
+	MaxLocationGroups        int                      // most groups one /api/groups request may define
+	EmptyTableBehavior       string                   // warn or unavailable: empty results while covid19 has no rows
+	PopulationTable          string                   // table holding location_key and a population column
+	PopulationColumn         string                   // population column of POPULATION_TABLE
+	PerCapitaZeroPopulation  string                   // null or exclude: per-capita handling of zero or unknown population
+	StreamBatchSize          int                      // rows written between flushes of streamed output
+	StreamWriteTimeout       time.Duration            // longest a streamed flush may block on a slow client
+	MetadataTable            string                   // table with one row per location_key, used by /api/location-keys
+	MetadataNameColumn       string                   // human-readable name column of METADATA_TABLE
+	ReadTimeout              time.Duration            // longest the server waits to read a request, body included; 0 disables
+	WriteTimeout             time.Duration            // longest a response write may take; streamed responses extend it themselves
+	IdleTimeout              time.Duration            // longest an idle keep-alive connection stays open
+	MaxSparklineLocations    int                      // most locations /api/sparklines accepts
+	FutureRows               string                   // exclude or include rows dated after today in reads
+	DateRangeOutsideData     string                   // clamp or overlap: how a date range reaching past the data is reported
+	MovingSumWindows         []int                    // trailing sum windows in days a request may choose
+	Int64AsString            bool                     // send cumulative counts as JSON strings unless a request sets int64_as_string
+	CORSExposeHeaders        []string                 // response headers exposed to browsers in addition to exposedHeaders
+	RequestIDHeaders         []string                 // incoming headers whose value is reused as request ID, in order of preference
+	ClickhouseAddrs          []string                 // ClickHouse replicas (host:port) queries are spread over
+	ReplicaRetry             bool                     // retry reads on another replica when one is unreachable
+	MaxRows                  int                      // most rows /api/timeseries returns as JSON; 0 disables the limit
+	MaxRowsV1                int                      // MaxRows for schema version 1 responses; 0 (default) keeps them unlimited
+	RowLimitBehavior         string                   // truncate or reject: results longer than MAX_ROWS
+	GrowthFactorWindow       int                      // days averaged before each date by /api/growth-factor unless a request sets window
+	MetadataDuplicates       string                   // collapse or warn: location keys repeated in METADATA_TABLE or POPULATION_TABLE
+	MetricAliases            []metricAlias            // alternative metric names requests may use, from METRIC_ALIASES
+	MetricAliasesInResponses bool                     // name metrics by their alias in JSON responses unless a request sets metric_aliases
+}
+
+var cfg Config
+
+// loadConfig reads the server configuration from environment variables
+func loadConfig() Config {
+	return Config{
+		Debug:                    getEnvBool("DEBUG", false),
+		UsePrewhere:              getEnvBool("USE_PREWHERE", true),
+		MaxLocationKeys:          getEnvInt("MAX_LOCATION_KEYS", 200),
+		AdminAPIKey:              getEnv("ADMIN_API_KEY", ""),
+		BodyLimit:                getEnvInt("BODY_LIMIT", 1<<20),
+		IngestBodyLimit:          getEnvInt("INGEST_BODY_LIMIT", 64<<20),
+		IngestBatchSize:          getEnvInt("INGEST_BATCH_SIZE", 10000),
+		ConsistencyChecks:        getEnvList("CONSISTENCY_CHECKS"),
+		ConsistencyInterval:      getEnvDuration("CONSISTENCY_CHECK_INTERVAL", 24*time.Hour),
+		ConsistencyTolerance:     getEnvInt("CONSISTENCY_TOLERANCE", 0),
+		UpdatedAtColumn:          getEnv("UPDATED_AT_COLUMN", "updated_at"),
+		DefaultSchemaVersion:     getEnvInt("DEFAULT_SCHEMA_VERSION", schemaV1),
+		DedupeReads:              getEnvBool("DEDUPE_READS", false),
+		MaxTopK:                  getEnvInt("MAX_TOP_K", 100),
+		PingInterval:             getEnvDuration("PING_INTERVAL", 30*time.Second),
+		PingTimeout:              getEnvDuration("PING_TIMEOUT", 5*time.Second),
+		UsageLogging:             getEnvBool("USAGE_LOGGING", false),
+		UsageBufferSize:          getEnvInt("USAGE_BUFFER_SIZE", 10000),
+		UsageFlushInterval:       getEnvDuration("USAGE_FLUSH_INTERVAL", 5*time.Second),
+		UsageStoreIPs:            getEnvBool("USAGE_STORE_IPS", false),
+		UsageStoreBodies:         getEnvBool("USAGE_STORE_BODIES", false),
+		MaxForecastHorizon:       getEnvInt("MAX_FORECAST_HORIZON", 30),
+		TestedUnit:               normalizeTestedUnit(getEnv("TESTED_UNIT", testedUnitTests)),
+		IntegrityCheckTimeout:    getEnvDuration("INTEGRITY_CHECK_TIMEOUT", 30*time.Second),
+		IntegritySampleSize:      getEnvInt("INTEGRITY_SAMPLE_SIZE", 10),
+		FloatPrecision:           getEnvInt("FLOAT_PRECISION", 4),
+		StalenessCadence:         normalizeCadence(getEnv("STALENESS_CADENCE", cadenceDaily)),
+		StalenessGraceDays:       getEnvInt("STALENESS_GRACE_DAYS", 1),
+		StalenessHolidays:        getEnvList("STALENESS_HOLIDAYS"),
+		LocationKeysConflict:     normalizeLocationKeysConflict(getEnv("LOCATION_KEYS_CONFLICT", conflictMerge)),
+		MaxAggregateGroups:       getEnvInt("MAX_AGGREGATE_GROUPS", 1000),
+		RejectAggregateOverflow:  getEnvBool("REJECT_AGGREGATE_OVERFLOW", false),
+		QueryTimeout:             getEnvDuration("QUERY_TIMEOUT", 30*time.Second),
+		QueryTimeouts:            queryTimeouts(getEnvList("QUERY_TIMEOUTS")),
+		QueryTimeoutStatus:       normalizeTimeoutStatus(getEnvInt("QUERY_TIMEOUT_STATUS", http.StatusGatewayTimeout)),
+		QueryTimeoutRetryAfter:   getEnvDuration("QUERY_TIMEOUT_RETRY_AFTER", 30*time.Second),
+		CacheMaxAge:              cacheMaxAge(getEnvList("CACHE_MAX_AGE")),
+		APIKeyQuotas:             parseQuotas(getEnvList("API_KEY_QUOTAS")),
+		DefaultDailyQuota:        getEnvInt("DEFAULT_DAILY_QUOTA", 0),
+		DefaultMonthlyQuota:      getEnvInt("DEFAULT_MONTHLY_QUOTA", 0),
+		MaxCorrelationLocations:  getEnvInt("MAX_CORRELATION_LOCATIONS", 20),
+		LatestRowStrategy:        normalizeLatestRowStrategy(getEnv("LATEST_ROW_STRATEGY", latestRowLimitBy)),
+		DefaultFields:            normalizeDefaultFields(getEnvList("DEFAULT_FIELDS")),
+		MaxHTMLRows:              getEnvInt("MAX_HTML_ROWS", 500),
+		Monotonicity:             normalizeMonotonicity(getEnv("MONOTONICITY", monotonicityOff)),
+		MaxLocationGroups:        getEnvInt("MAX_LOCATION_GROUPS", 20),
+		EmptyTableBehavior:       normalizeEmptyTableBehavior(getEnv("EMPTY_TABLE_BEHAVIOR", emptyTableWarn)),
+		PopulationTable:          getEnv("POPULATION_TABLE", "demographics"),
+		PopulationColumn:         getEnv("POPULATION_COLUMN", "population"),
+		PerCapitaZeroPopulation:  normalizePerCapitaZero(getEnv("PER_CAPITA_ZERO_POPULATION", perCapitaNull)),
+		StreamBatchSize:          max(getEnvInt("STREAM_BATCH_SIZE", 1000), 1),
+		StreamWriteTimeout:       getEnvDuration("STREAM_WRITE_TIMEOUT", 30*time.Second),
+		MetadataTable:            getEnv("METADATA_TABLE", "index"),
+		MetadataNameColumn:       getEnv("METADATA_NAME_COLUMN", "country_name"),
+		ReadTimeout:              getEnvDuration("READ_TIMEOUT", 30*time.Second),
+		WriteTimeout:             getEnvDuration("WRITE_TIMEOUT", time.Minute),
+		IdleTimeout:              getEnvDuration("IDLE_TIMEOUT", 2*time.Minute),
+		MaxSparklineLocations:    getEnvInt("MAX_SPARKLINE_LOCATIONS", 100),
+		FutureRows:               normalizeFutureRows(getEnv("FUTURE_ROWS", futureExclude)),
+		DateRangeOutsideData:     normalizeDateRangeOutsideData(getEnv("DATE_RANGE_OUTSIDE_DATA", dateRangeClamp)),
+		MovingSumWindows:         movingSumWindows(splitList(getEnv("MOVING_SUM_WINDOWS", "7,14,28"))),
+		Int64AsString:            getEnvBool("INT64_AS_STRING", false),
+		CORSExposeHeaders:        getEnvList("CORS_EXPOSE_HEADERS"),
+		RequestIDHeaders:         splitList(getEnv("REQUEST_ID_HEADERS", requestIDHeader+","+traceparentHeader)),
+		ClickhouseAddrs:          splitList(getEnv("CLICKHOUSE_ADDRS", "localhost:9000")),
+		ReplicaRetry:             getEnvBool("REPLICA_RETRY", true),
+		MaxRows:                  getEnvInt("MAX_ROWS", 10000),
+		MaxRowsV1:                getEnvInt("MAX_ROWS_V1", 0),
+		RowLimitBehavior:         normalizeRowLimitBehavior(getEnv("ROW_LIMIT_BEHAVIOR", rowLimitTruncate)),
+		GrowthFactorWindow:       min(max(getEnvInt("GROWTH_FACTOR_WINDOW", 7), 1), maxGrowthFactorWindow),
+		MetadataDuplicates:       normalizeMetadataDuplicates(getEnv("METADATA_DUPLICATES", metadataDuplicatesCollapse)),
+		MetricAliases:            normalizeMetricAliases(getEnvList("METRIC_ALIASES")),
+		MetricAliasesInResponses: getEnvBool("METRIC_ALIASES_IN_RESPONSES", false),
+	}
+}
+
+// getEnv returns the value of the environment variable or the fallback when unset
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getEnvBool parses a boolean environment variable, returning the fallback when unset or invalid
+func getEnvBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(getEnv(key, ""))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// getEnvInt parses an integer environment variable, returning the fallback when unset or invalid
+func getEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(getEnv(key, ""))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// getEnvDuration parses a duration environment variable such as "30s", returning the fallback when unset or invalid
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(getEnv(key, ""))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// getEnvList splits a comma-separated environment variable, dropping empty items
+func getEnvList(key string) []string {
+	return splitList(getEnv(key, ""))
+}
+
+// splitList splits a comma-separated list, trimming items and dropping empty ones
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
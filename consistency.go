@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// consistencyCheck is one table-wide invariant. Violations selects the offending rows
+// as (location_key, date, detail); counts and samples are both derived from it.
+type consistencyCheck struct {
+	Name        string
+	Description string
+	Violations  string
+	Args        func() []interface{} // Optional: positional arguments for Violations
+}
+
+// dayOverDay exposes each row next to the previous day's cumulative values of its location
+const dayOverDay = `
+		SELECT location_key, date,
+			   cumulative_confirmed, cumulative_deceased, new_confirmed, new_deceased,
+			   lagInFrame(cumulative_confirmed) OVER w AS prev_confirmed,
+			   lagInFrame(cumulative_deceased) OVER w AS prev_deceased,
+			   row_number() OVER w AS rn
+		FROM covid19
+		WINDOW w AS (PARTITION BY location_key ORDER BY date ROWS BETWEEN 1 PRECEDING AND CURRENT ROW)`
+
+// consistencyChecks are the invariants verified by the consistency job, enabled via CONSISTENCY_CHECKS
+var consistencyChecks = []consistencyCheck{
+	{
+		Name: "cumulative_decrease",
+		Description: "Rows whose cumulative_confirmed or cumulative_deceased is lower than the previous day " +
+			"without a negative daily value reporting the correction",
+		Violations: `
+	SELECT location_key, date,
+		   format('confirmed {} -> {}, deceased {} -> {}', toString(prev_confirmed), toString(cumulative_confirmed),
+				  toString(prev_deceased), toString(cumulative_deceased)) AS detail
+	FROM (` + dayOverDay + `
+	)
+	WHERE rn > 1
+	  AND ((cumulative_confirmed < prev_confirmed AND new_confirmed >= 0)
+	    OR (cumulative_deceased < prev_deceased AND new_deceased >= 0))`,
+	},
+	{
+		Name:        "daily_cumulative_mismatch",
+		Description: "Rows whose new_confirmed or new_deceased differs from the day-over-day cumulative delta by more than CONSISTENCY_TOLERANCE",
+		Violations: `
+	SELECT location_key, date,
+		   format('new_confirmed {} vs delta {}, new_deceased {} vs delta {}',
+				  toString(new_confirmed), toString(cumulative_confirmed - prev_confirmed),
+				  toString(new_deceased), toString(cumulative_deceased - prev_deceased)) AS detail
+	FROM (` + dayOverDay + `
+	)
+	WHERE rn > 1
+	  AND (abs((cumulative_confirmed - prev_confirmed) - new_confirmed) > ?
+	    OR abs((cumulative_deceased - prev_deceased) - new_deceased) > ?)`,
+		Args: func() []interface{} {
+			return []interface{}{cfg.ConsistencyTolerance, cfg.ConsistencyTolerance}
+		},
+	},
+	{
+		// The table has no source column, so duplicates are keyed on (location_key, date)
+		Name:        "duplicate_rows",
+		Description: "(location_key, date) pairs stored more than once after merges",
+		Violations: `
+	SELECT location_key, date, format('{} copies', toString(count())) AS detail
+	FROM covid19
+	GROUP BY location_key, date
+	HAVING count() > 1`,
+	},
+	{
+		Name:        "future_dates",
+		Description: "Rows dated after today",
+		Violations:  `SELECT location_key, date, '' AS detail FROM covid19 WHERE date > today()`,
+	},
+}
+
+// args returns the check's positional arguments
+func (check consistencyCheck) args() []interface{} {
+	if check.Args == nil {
+		return nil
+	}
+	return check.Args()
+}
+
+// countViolations returns how many rows violate the check
+func (check consistencyCheck) countViolations(ctx context.Context) (uint64, error) {
+	var count uint64
+	err := db.QueryRow(ctx, "SELECT count() FROM ("+check.Violations+")", check.args()...).Scan(&count)
+	return count, err
+}
+
+// consistencyResult is the outcome of one check within a run
+type consistencyResult struct {
+	CheckedAt  time.Time `json:"checked_at"`
+	Check      string    `json:"check"`
+	Violations uint64    `json:"violations"`
+	DurationMs uint64    `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// consistencyRunning guards against overlapping runs
+var consistencyRunning sync.Mutex
+
+// enabledConsistencyChecks returns the checks selected by CONSISTENCY_CHECKS
+func enabledConsistencyChecks() []consistencyCheck {
+	enabled := map[string]bool{}
+	for _, name := range cfg.ConsistencyChecks {
+		enabled[name] = true
+	}
+	var checks []consistencyCheck
+	for _, check := range consistencyChecks {
+		if len(enabled) == 0 || enabled[check.Name] {
+			checks = append(checks, check)
+		}
+	}
+	return checks
+}
+
+// runConsistencyChecks runs the checks unless a run is already in progress, in which case
+// it returns false
+func runConsistencyChecks(ctx context.Context) ([]consistencyResult, bool) {
+	if !consistencyRunning.TryLock() {
+		return nil, false
+	}
+	defer consistencyRunning.Unlock()
+	return checkConsistency(ctx), true
+}
+
+// checkConsistency runs every enabled check, stores one report row per check and updates
+// the violation gauges. The caller holds consistencyRunning.
+func checkConsistency(ctx context.Context) []consistencyResult {
+	checkedAt := time.Now().UTC().Truncate(time.Second)
+
+	var results []consistencyResult
+	writer := newBatchWriter("consistency_reports", []string{"checked_at", "check", "violations", "duration_ms", "error"}, len(consistencyChecks))
+	for _, check := range enabledConsistencyChecks() {
+		start := time.Now()
+		result := consistencyResult{CheckedAt: checkedAt, Check: check.Name}
+		violations, err := check.countViolations(ctx)
+		result.Violations = violations
+		if err != nil {
+			result.Error = err.Error()
+			logContextf(ctx, "consistency check %s failed: %v", check.Name, err)
+		} else {
+			consistencyViolations.WithLabelValues(check.Name).Set(float64(result.Violations))
+		}
+		result.DurationMs = uint64(time.Since(start).Milliseconds())
+		results = append(results, result)
+
+		if err := writer.Add(ctx, result.CheckedAt, result.Check, result.Violations, result.DurationMs, result.Error); err != nil {
+			logContextf(ctx, "failed to store consistency report: %v", err)
+		}
+	}
+	if err := writer.Flush(ctx); err != nil {
+		logContextf(ctx, "failed to store consistency report: %v", err)
+	}
+	return results
+}
+
+// startConsistencyJob runs the checks every CONSISTENCY_CHECK_INTERVAL until ctx is done
+func startConsistencyJob(ctx context.Context) {
+	if cfg.ConsistencyInterval <= 0 {
+		return
+	}
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		ticker := time.NewTicker(cfg.ConsistencyInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				runConsistencyChecks(ctx)
+			}
+		}
+	}()
+}
+
+// triggerConsistencyCheck handles POST /api/admin/consistency-check by starting a run in the
+// background. The run keeps the lock taken here, so a second trigger cannot slip in before
+// it starts, and stops with the process rather than with the request.
+func triggerConsistencyCheck(c *fiber.Ctx) error {
+	if !consistencyRunning.TryLock() {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "A consistency check is already running"})
+	}
+
+	ctx := context.WithValue(shutdown, requestIDKey{}, requestIDOf(c))
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		defer consistencyRunning.Unlock()
+		checkConsistency(ctx)
+	}()
+	c.Status(http.StatusAccepted)
+	return sendJSON(c, fiber.Map{"status": "started"})
+}
+
+// getConsistencyReport handles GET /api/admin/consistency, returning the rows of the latest run
+func getConsistencyReport(c *fiber.Ctx) error {
+	query := `
+	SELECT checked_at, check, violations, duration_ms, error
+	FROM consistency_reports
+	WHERE checked_at = (SELECT max(checked_at) FROM consistency_reports)
+	ORDER BY check
+	`
+	rows, err := db.Query(c.UserContext(), query)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Query execution failed: " + err.Error()})
+	}
+	defer rows.Close()
+
+	results := []consistencyResult{}
+	for rows.Next() {
+		var r consistencyResult
+		if err := rows.Scan(&r.CheckedAt, &r.Check, &r.Violations, &r.DurationMs, &r.Error); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Row scan failed: " + err.Error()})
+		}
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading rows"})
+	}
+	return sendJSON(c, results)
+}
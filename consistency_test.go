@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestTriggerConsistencyCheck(t *testing.T) {
+	defer func(old []string) { cfg.ConsistencyChecks = old }(cfg.ConsistencyChecks)
+	cfg.ConsistencyChecks = []string{"future_dates"}
+	out := captureLog(t)
+	release := make(chan struct{})
+	useStubConn(t, func(query string, args ...any) driver.Row {
+		<-release
+		return stubRow{values: []any{uint64(0)}}
+	})
+
+	app := fiber.New()
+	app.Post("/", requestID, triggerConsistencyCheck)
+	trigger := func() int {
+		t.Helper()
+		req := httptest.NewRequest(fiber.MethodPost, "/", nil)
+		req.Header.Set(requestIDHeader, "admin-1")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	if status := trigger(); status != fiber.StatusAccepted {
+		t.Fatalf("first trigger: status %d, want 202", status)
+	}
+	// The first run holds the lock until it finishes, even before it has queried
+	if status := trigger(); status != fiber.StatusConflict {
+		t.Errorf("trigger during a run: status %d, want 409", status)
+	}
+	close(release)
+	background.Wait()
+	if status := trigger(); status != fiber.StatusAccepted {
+		t.Errorf("trigger after the run: status %d, want 202", status)
+	}
+	background.Wait()
+
+	// The stub refuses the report writes, which are logged with the triggering request
+	if !strings.Contains(out.String(), "request admin-1: failed to store consistency report") {
+		t.Errorf("log = %q, want the report failure of request admin-1", out.String())
+	}
+}
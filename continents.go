@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// continentOther collects the countries missing from continentCountries
+const continentOther = "Other"
+
+// continentCountries maps each continent to the ISO 3166-1 alpha-2 codes (level 0
+// location keys) of its countries and territories, following the UN geoscheme;
+// transcontinental countries are assigned where the geoscheme puts them (TR, CY and the
+// Caucasus in Asia, RU in Europe)
+var continentCountries = map[string][]string{
+	"Africa": {"AO", "BF", "BI", "BJ", "BW", "CD", "CF", "CG", "CI", "CM", "CV", "DJ", "DZ", "EG", "EH", "ER", "ET",
+		"GA", "GH", "GM", "GN", "GQ", "GW", "KE", "KM", "LR", "LS", "LY", "MA", "MG", "ML", "MR", "MU", "MW", "MZ",
+		"NA", "NE", "NG", "RE", "RW", "SC", "SD", "SH", "SL", "SN", "SO", "SS", "ST", "SZ", "TD", "TG", "TN", "TZ",
+		"UG", "YT", "ZA", "ZM", "ZW"},
+	"Antarctica": {"AQ", "BV", "GS", "HM", "TF"},
+	"Asia": {"AE", "AF", "AM", "AZ", "BD", "BH", "BN", "BT", "CC", "CN", "CX", "CY", "GE", "HK", "ID", "IL", "IN",
+		"IO", "IQ", "IR", "JO", "JP", "KG", "KH", "KP", "KR", "KW", "KZ", "LA", "LB", "LK", "MM", "MN", "MO", "MV",
+		"MY", "NP", "OM", "PH", "PK", "PS", "QA", "SA", "SG", "SY", "TH", "TJ", "TL", "TM", "TR", "TW", "UZ", "VN",
+		"YE"},
+	"Europe": {"AD", "AL", "AT", "AX", "BA", "BE", "BG", "BY", "CH", "CZ", "DE", "DK", "EE", "ES", "FI", "FO", "FR",
+		"GB", "GG", "GI", "GR", "HR", "HU", "IE", "IM", "IS", "IT", "JE", "LI", "LT", "LU", "LV", "MC", "MD", "ME",
+		"MK", "MT", "NL", "NO", "PL", "PT", "RO", "RS", "RU", "SE", "SI", "SJ", "SK", "SM", "UA", "VA", "XK"},
+	"North America": {"AG", "AI", "AW", "BB", "BL", "BM", "BQ", "BS", "BZ", "CA", "CR", "CU", "CW", "DM", "DO", "GD",
+		"GL", "GP", "GT", "HN", "HT", "JM", "KN", "KY", "LC", "MF", "MQ", "MS", "MX", "NI", "PA", "PM", "PR", "SV",
+		"SX", "TC", "TT", "UM", "US", "VC", "VG", "VI"},
+	"Oceania": {"AS", "AU", "CK", "FJ", "FM", "GU", "KI", "MH", "MP", "NC", "NF", "NR", "NU", "NZ", "PF", "PG", "PN",
+		"PW", "SB", "TK", "TO", "TV", "VU", "WF", "WS"},
+	"South America": {"AR", "BO", "BR", "CL", "CO", "EC", "FK", "GF", "GY", "PE", "PY", "SR", "UY", "VE"},
+}
+
+// ContinentsRequest selects the date range and metrics summed per continent
+type ContinentsRequest struct {
+	StartDate  string   `json:"start_date"`           // Required
+	EndDate    string   `json:"end_date"`             // Required
+	Continents []string `json:"continents,omitempty"` // Optional: only these continents (all when empty)
+	Fields     []string `json:"fields,omitempty"`
+	AsOf       string   `json:"as_of,omitempty"`
+	Dedupe     *bool    `json:"dedupe,omitempty"`
+	DateFormat string   `json:"date_format,omitempty"`
+}
+
+// ContinentSeriesData is one continent's summed metrics for a day
+type ContinentSeriesData struct {
+	Continent string           `json:"continent"`
+	Date      Date             `json:"date"`
+	Locations uint64           `json:"locations"` // countries with a row that day
+	Values    map[string]int64 `json:"values"`
+}
+
+// validate checks the date range and the continent names
+func (r ContinentsRequest) validate() error {
+	if _, _, err := parseDateRange("start_date", r.StartDate, "end_date", r.EndDate); err != nil {
+		return err
+	}
+	for _, continent := range r.Continents {
+		if _, ok := continentCountries[continent]; !ok && continent != continentOther {
+			return fmt.Errorf("unknown continent %q", continent)
+		}
+	}
+	return nil
+}
+
+// continentMapping returns the parallel country and continent arrays for transform()
+func continentMapping() ([]string, []string) {
+	names := make([]string, 0, len(continentCountries))
+	for continent := range continentCountries {
+		names = append(names, continent)
+	}
+	sort.Strings(names)
+	var countries, continents []string
+	for _, continent := range names {
+		for _, country := range continentCountries[continent] {
+			countries = append(countries, country)
+			continents = append(continents, continent)
+		}
+	}
+	return countries, continents
+}
+
+// getContinents handles POST /api/continents, summing the country-level (level 0) series
+// of each continent per day. Countries missing from continentCountries are summed into
+// "Other" rather than dropped, so the continents always add up to the world total.
+func getContinents(c *fiber.Ctx) error {
+	var req ContinentsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid filter parameters"})
+	}
+	if err := req.validate(); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	filter := FilterRequest{StartDate: req.StartDate, EndDate: req.EndDate, Fields: req.Fields, AsOf: req.AsOf, Dedupe: req.Dedupe}
+	columns, err := resolveFields(req.Fields)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	format, err := resolveDateFormat(c, req.DateFormat)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	reads, readArgs, err := filter.readConditions(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	recordUsageFilter(c, nil, req.StartDate, req.EndDate)
+	clampDateRange(c, req.StartDate, req.EndDate)
+
+	countries, continents := continentMapping()
+	sums := make([]string, len(columns))
+	for i, column := range columns {
+		sums[i] = "sum(" + column + ") AS " + column
+	}
+	conditions := append([]string{locationLevel + " = 0", "date BETWEEN ? AND ?"}, reads...)
+	args := append([]interface{}{countries, continents, continentOther, req.StartDate, req.EndDate}, readArgs...)
+	query := `
+	SELECT transform(location_key, ?, ?, ?) AS continent, date, uniqExact(location_key) AS locations, ` + join(sums, ", ") + `
+	FROM ` + readSource(conditions, filter.dedupe()) + `
+	GROUP BY continent, date`
+	if len(req.Continents) > 0 {
+		query += "\n\tHAVING has(?, continent)"
+		args = append(args, req.Continents)
+	}
+	query += "\n\tORDER BY continent, date"
+
+	rows, err := db.Query(c.UserContext(), query, args...)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Query execution failed: " + err.Error()})
+	}
+	defer rows.Close()
+
+	data := []ContinentSeriesData{}
+	for rows.Next() {
+		s := ContinentSeriesData{Date: Date{format: format}, Values: make(map[string]int64, len(columns))}
+		values := make([]int64, len(columns))
+		dest := []interface{}{&s.Continent, &s.Date.Time, &s.Locations}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Row scan failed: " + err.Error()})
+		}
+		for i, column := range columns {
+			s.Values[column] = values[i]
+		}
+		data = append(data, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading rows"})
+	}
+
+	return respond(c, data)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CorrelationRequest selects the locations, metric and date range to correlate
+type CorrelationRequest struct {
+	FilterRequest
+	Metric string `json:"metric"` // Required: metric column to correlate
+}
+
+// CorrelationMatrix holds the pairwise Pearson correlations of the locations' series.
+// Matrix[i][j] correlates Locations[i] with Locations[j] over the Observations[i][j]
+// days both reported; it is null when fewer than three days overlap or a series is constant.
+type CorrelationMatrix struct {
+	Locations    []string     `json:"locations"`
+	Matrix       [][]*float64 `json:"matrix"`
+	Observations [][]int      `json:"observations"`
+}
+
+// validate checks the metric and the required date range
+func (r CorrelationRequest) validate() error {
+	if !isMetricColumn(r.Metric) {
+		return fmt.Errorf("unknown metric %q", r.Metric)
+	}
+	_, _, err := parseDateRange("start_date", r.StartDate, "end_date", r.EndDate)
+	return err
+}
+
+// getCorrelation handles POST /api/correlation. Series are aligned by date pairwise:
+// each pair is correlated over the days on which both locations have a row, so a gap in
+// one location does not shorten the other pairs.
+func getCorrelation(c *fiber.Ctx) error {
+	var req CorrelationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid filter parameters"})
+	}
+	if err := req.validate(); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	keys, err := req.locationKeys()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	// The matrix grows with the square of the locations
+	if len(keys) < 2 || len(keys) > cfg.MaxCorrelationLocations {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("correlation needs between 2 and %d location keys, got %d", cfg.MaxCorrelationLocations, len(keys)),
+		})
+	}
+	recordUsageFilter(c, keys, req.StartDate, req.EndDate)
+	clampDateRange(c, req.StartDate, req.EndDate)
+
+	location, locationArg := locationCondition(keys)
+	conditions := []string{location, "date BETWEEN ? AND ?"}
+	args := []interface{}{locationArg, req.StartDate, req.EndDate}
+	reads, readArgs, err := req.readConditions(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	conditions = append(conditions, reads...)
+	args = append(args, readArgs...)
+
+	query := `
+	SELECT location_key, date, ` + req.Metric + `
+	FROM ` + readSource(conditions, req.dedupe())
+
+	rows, err := db.Query(c.UserContext(), query, args...)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Query execution failed: " + err.Error()})
+	}
+	defer rows.Close()
+
+	series := map[string]map[time.Time]float64{}
+	for rows.Next() {
+		var key string
+		var date time.Time
+		var value int32
+		if err := rows.Scan(&key, &date, &value); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Row scan failed: " + err.Error()})
+		}
+		if series[key] == nil {
+			series[key] = map[time.Time]float64{}
+		}
+		series[key][date] = float64(value)
+	}
+
+	if err := rows.Err(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading rows"})
+	}
+
+	result := CorrelationMatrix{
+		Locations:    make([]string, len(keys)),
+		Matrix:       make([][]*float64, len(keys)),
+		Observations: make([][]int, len(keys)),
+	}
+	for i, key := range keys {
+		result.Locations[i] = key.(string)
+		result.Matrix[i] = make([]*float64, len(keys))
+		result.Observations[i] = make([]int, len(keys))
+	}
+	for i := range keys {
+		for j := i; j < len(keys); j++ {
+			r, n := pearson(series[result.Locations[i]], series[result.Locations[j]])
+			result.Matrix[i][j], result.Matrix[j][i] = r, r
+			result.Observations[i][j], result.Observations[j][i] = n, n
+		}
+	}
+
+	return respond(c, result)
+}
+
+// pearson correlates two series over their common dates, returning nil when fewer than
+// three dates overlap or either side has no variance
+func pearson(a, b map[time.Time]float64) (*float64, int) {
+	var n, sumX, sumY, sumXX, sumYY, sumXY float64
+	for date, x := range a {
+		y, ok := b[date]
+		if !ok {
+			continue
+		}
+		n++
+		sumX += x
+		sumY += y
+		sumXX += x * x
+		sumYY += y * y
+		sumXY += x * y
+	}
+	if n < 3 {
+		return nil, int(n)
+	}
+	cov := n*sumXY - sumX*sumY
+	varX := n*sumXX - sumX*sumX
+	varY := n*sumYY - sumY*sumY
+	if varX <= 0 || varY <= 0 {
+		return nil, int(n)
+	}
+	r := round(cov / math.Sqrt(varX*varY))
+	return &r, int(n)
+}
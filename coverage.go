@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CoverageRequest selects the locations whose testing coverage is returned
+type CoverageRequest struct {
+	FilterRequest
+	Date string `json:"date"` // Optional: use the latest report on or before this date instead of the latest overall
+}
+
+// CoverageData is a location's cumulative tested count relative to its population
+type CoverageData struct {
+	LocationKey      string   `json:"location_key"`
+	Date             *Date    `json:"date"`              // latest day with cumulative_tested reported; null if never
+	CumulativeTested *int64   `json:"cumulative_tested"` // null if never reported
+	Population       uint64   `json:"population"`        // 0 when unknown
+	TestedPerPerson  *float64 `json:"tested_per_person"` // cumulative_tested / population; null without both
+}
+
+// getTestingCoverage handles POST /api/testing-coverage: for each location, its latest
+// positive cumulative_tested divided by its POPULATION_TABLE population. A zero
+// cumulative_tested is taken as not reported, so it yields null rather than zero coverage,
+// and so does a zero or unknown population (or, with PER_CAPITA_ZERO_POPULATION=exclude,
+// the location is left out).
+func getTestingCoverage(c *fiber.Ctx) error {
+	var req CoverageRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid filter parameters"})
+	}
+	if req.Date != "" {
+		if _, err := parseDate(req.Date); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("date: %v", err)})
+		}
+	}
+	keys, err := req.locationKeys()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	format, err := resolveDateFormat(c, req.DateFormat)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	reads, readArgs, err := req.readConditions(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	recordUsageFilter(c, keys, "", req.Date)
+
+	var conditions []string
+	var args []interface{}
+	if len(keys) > 0 {
+		condition, arg := locationCondition(keys)
+		conditions = append(conditions, condition)
+		args = append(args, arg)
+	}
+	if req.Date != "" {
+		date, _ := parseDate(req.Date)
+		conditions = append(conditions, "date <= ?")
+		args = append(args, date.Format(time.DateOnly))
+	}
+	conditions = append(conditions, reads...)
+	args = append(args, readArgs...)
+	if cfg.PerCapitaZeroPopulation == perCapitaExclude {
+		conditions = append(conditions, fmt.Sprintf(withPopulation, populationSource()))
+	}
+
+	query := `
+	SELECT t.location_key, t.reports, t.tested_date, t.tested, toUInt64(if(p.population > 0, p.population, 0)) AS population
+	FROM (
+		SELECT location_key,
+			   countIf(cumulative_tested > 0) AS reports,
+			   maxIf(date, cumulative_tested > 0) AS tested_date,
+			   toInt64(argMaxIf(cumulative_tested, date, cumulative_tested > 0)) AS tested
+		FROM ` + readSource(conditions, req.dedupe()) + `
+		GROUP BY location_key
+	) AS t
+	LEFT JOIN ` + populationSource() + ` AS p USING (location_key)
+	ORDER BY t.location_key`
+
+	rows, err := db.Query(c.UserContext(), query, args...)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Query execution failed: " + err.Error()})
+	}
+	defer rows.Close()
+
+	data := []CoverageData{}
+	for rows.Next() {
+		var d CoverageData
+		var reports uint64
+		var date Date
+		var tested int64
+		if err := rows.Scan(&d.LocationKey, &reports, &date.Time, &tested, &d.Population); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Row scan failed: " + err.Error()})
+		}
+		if reports > 0 {
+			date.format = format
+			d.Date, d.CumulativeTested = &date, &tested
+			if d.Population > 0 {
+				ratio := round(float64(tested) / float64(d.Population))
+				d.TestedPerPerson = &ratio
+			}
+		}
+		data = append(data, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading rows"})
+	}
+
+	warnDuplicateKeys(c, cfg.PopulationTable)
+	labelTesting(c)
+	return respond(c, data)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// dateFormat selects how Date values are serialized in responses
+type dateFormat string
+
+const (
+	dateFormatDate      dateFormat = "date"       // "2021-03-05"
+	dateFormatRFC3339   dateFormat = "rfc3339"    // "2021-03-05T00:00:00Z"
+	dateFormatEpochDays dateFormat = "epoch_days" // days since 1970-01-01, as a number
+	dateFormatEpochMs   dateFormat = "epoch_ms"   // Unix milliseconds of midnight UTC, as a number
+)
+
+// Date is a calendar date in responses. The zero format serializes as a plain date.
+type Date struct {
+	time.Time
+	format dateFormat
+}
+
+// resolveDateFormat validates the requested date_format. Schema version 1 keeps its
+// original RFC3339 output unless a format is asked for explicitly.
+func resolveDateFormat(c *fiber.Ctx, requested string) (dateFormat, error) {
+	switch f := dateFormat(requested); f {
+	case dateFormatDate, dateFormatRFC3339, dateFormatEpochDays, dateFormatEpochMs:
+		return f, nil
+	case "":
+		if schemaVersion(c) == schemaV1 {
+			return dateFormatRFC3339, nil
+		}
+		return dateFormatDate, nil
+	default:
+		return "", fmt.Errorf("unknown date_format %q", requested)
+	}
+}
+
+// epochDays returns the number of days between 1970-01-01 and d
+func (d Date) epochDays() int64 {
+	seconds := d.Unix()
+	days := seconds / 86400
+	if seconds%86400 < 0 {
+		days--
+	}
+	return days
+}
+
+// String renders d in its format; text encoders such as CSV use it
+func (d Date) String() string {
+	switch d.format {
+	case dateFormatRFC3339:
+		return d.Time.Format(time.RFC3339)
+	case dateFormatEpochDays:
+		return strconv.FormatInt(d.epochDays(), 10)
+	case dateFormatEpochMs:
+		return strconv.FormatInt(d.UnixMilli(), 10)
+	default:
+		return d.Time.Format(time.DateOnly)
+	}
+}
+
+// MarshalJSON renders d in its format. RFC3339 output is identical to time.Time's.
+func (d Date) MarshalJSON() ([]byte, error) {
+	switch d.format {
+	case dateFormatRFC3339:
+		return d.Time.MarshalJSON()
+	case dateFormatEpochDays, dateFormatEpochMs:
+		return []byte(d.String()), nil
+	default:
+		return []byte(strconv.Quote(d.String())), nil
+	}
+}
+
+// UnmarshalJSON accepts a plain date or an RFC3339 timestamp
+func (d *Date) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	value, err := strconv.Unquote(string(data))
+	if err != nil {
+		return fmt.Errorf("invalid date %s", data)
+	}
+	t, err := parseDate(value)
+	if err != nil {
+		return err
+	}
+	d.Time = t
+	return nil
+}
+
+// parseDate accepts YYYY-MM-DD or RFC3339 values
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, errors.New("date is required")
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	return t, nil
+}
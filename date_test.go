@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDateMarshalJSONGolden(t *testing.T) {
+	// Before and after the epoch, so negative epoch days round towards the earlier day
+	days := []time.Time{
+		time.Date(2021, 3, 5, 0, 0, 0, 0, time.UTC),
+		time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC),
+	}
+	formats := []struct {
+		golden string
+		format dateFormat
+	}{
+		{"date_default.golden", ""},
+		{"date_date.golden", dateFormatDate},
+		{"date_rfc3339.golden", dateFormatRFC3339},
+		{"date_epoch_days.golden", dateFormatEpochDays},
+		{"date_epoch_ms.golden", dateFormatEpochMs},
+	}
+	for _, f := range formats {
+		t.Run(string(f.format), func(t *testing.T) {
+			var out bytes.Buffer
+			for _, day := range days {
+				data, err := json.Marshal(Date{Time: day, format: f.format})
+				if err != nil {
+					t.Fatal(err)
+				}
+				out.Write(data)
+				out.WriteByte('\n')
+			}
+			checkGolden(t, f.golden, out.Bytes())
+		})
+	}
+}
+
+func TestDateRFC3339MatchesTime(t *testing.T) {
+	day := time.Date(2021, 3, 5, 0, 0, 0, 0, time.UTC)
+	got, _ := json.Marshal(Date{Time: day, format: dateFormatRFC3339})
+	want, _ := json.Marshal(day)
+	if !bytes.Equal(got, want) {
+		t.Errorf("rfc3339 = %s, want time.Time's %s", got, want)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Signalling of requested date ranges reaching past the available data, see
+// DATE_RANGE_OUTSIDE_DATA. Either way only the overlapping dates can match.
+const (
+	dateRangeClamp   = "clamp"   // report the clamped range in meta.date_range with a warning
+	dateRangeOverlap = "overlap" // return the overlapping rows without comment
+)
+
+// normalizeDateRangeOutsideData validates DATE_RANGE_OUTSIDE_DATA, defaulting to clamp
+func normalizeDateRangeOutsideData(behavior string) string {
+	if behavior == dateRangeOverlap {
+		return behavior
+	}
+	return dateRangeClamp
+}
+
+// availableRangeCheckInterval bounds how often the available date range is re-read
+const availableRangeCheckInterval = time.Minute
+
+// availableRange caches the earliest and latest date readable from covid19
+var availableRange struct {
+	sync.Mutex
+	checked     time.Time
+	first, last time.Time
+	ok          bool
+}
+
+// dataDateRange returns the earliest and latest date in covid19, leaving out future-dated
+// rows like reads do, checked at most once per interval. ok is false while the table is
+// empty or when the check fails.
+func dataDateRange(c *fiber.Ctx) (first, last time.Time, ok bool) {
+	availableRange.Lock()
+	defer availableRange.Unlock()
+	if time.Since(availableRange.checked) < availableRangeCheckInterval {
+		return availableRange.first, availableRange.last, availableRange.ok
+	}
+	query := "SELECT min(date), max(date), count() FROM covid19"
+	if cfg.FutureRows == futureExclude {
+		query += " WHERE date <= today()"
+	}
+	var rows uint64
+	if err := db.QueryRow(c.UserContext(), query).Scan(&first, &last, &rows); err != nil {
+		return first, last, false
+	}
+	found := rows > 0
+	availableRange.checked = time.Now()
+	availableRange.first, availableRange.last, availableRange.ok = first.UTC(), last.UTC(), found
+	return availableRange.first, availableRange.last, found
+}
+
+// clampDateRange reports a requested start_date/end_date that reaches before the earliest
+// or after the latest available date: under DATE_RANGE_OUTSIDE_DATA=clamp the response
+// carries the range actually covered in meta.date_range and a warning. The query itself
+// is unchanged, since dates outside the data match no rows anyway.
+func clampDateRange(c *fiber.Ctx, startDate, endDate string) {
+	if cfg.DateRangeOutsideData != dateRangeClamp || startDate == "" || endDate == "" {
+		return
+	}
+	start, end, err := parseDateRange("start_date", startDate, "end_date", endDate)
+	if err != nil {
+		return
+	}
+	first, last, ok := dataDateRange(c)
+	if !ok || (!start.Before(first) && !end.After(last)) {
+		return
+	}
+	if start.Before(first) {
+		start = first
+	}
+	if end.After(last) {
+		end = last
+	}
+	if start.After(end) {
+		addWarning(c, "date range outside the available data ("+first.Format(time.DateOnly)+" to "+last.Format(time.DateOnly)+")")
+		return
+	}
+	addMeta(c, "date_range", fiber.Map{"start_date": start.Format(time.DateOnly), "end_date": end.Format(time.DateOnly)})
+	addWarning(c, "date range clamped to the available data: "+start.Format(time.DateOnly)+" to "+end.Format(time.DateOnly))
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// sensitiveHeaders are never echoed back in generated curl commands
+var sensitiveHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"x-api-key":           true,
+}
+
+// skippedHeaders are recomputed by curl itself and only add noise
+var skippedHeaders = map[string]bool{
+	"host":           true,
+	"content-length": true,
+	"connection":     true,
+}
+
+// dryRunResponse builds the debug payload returned instead of executing a query
+func dryRunResponse(c *fiber.Ctx, query string, args []interface{}, body interface{}) (fiber.Map, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return fiber.Map{
+		"query": query,
+		"args":  args,
+		"curl":  curlCommand(c, payload),
+	}, nil
+}
+
+// bodyHeaders describe the original body encoding, which the re-encoded body replaces
+var bodyHeaders = map[string]bool{
+	"content-type":     true,
+	"content-encoding": true,
+}
+
+// curlCommand renders a shell command reproducing the current request with the given
+// body. The body is the parsed request encoded again as JSON, so it is sent as such
+// whatever the original request's Content-Type (a form, say) or encoding.
+func curlCommand(c *fiber.Ctx, body []byte) string {
+	var headers []string
+	if len(body) > 0 {
+		headers = append(headers, "-H "+shellQuote(fiber.HeaderContentType+": "+fiber.MIMEApplicationJSON))
+	}
+	c.Request().Header.VisitAll(func(key, value []byte) {
+		name := string(key)
+		lower := strings.ToLower(name)
+		if skippedHeaders[lower] || len(body) > 0 && bodyHeaders[lower] {
+			return
+		}
+		val := string(value)
+		if sensitiveHeaders[lower] {
+			val = "REDACTED"
+		}
+		headers = append(headers, "-H "+shellQuote(name+": "+val))
+	})
+	sort.Strings(headers)
+
+	parts := []string{"curl", "-X", c.Method(), shellQuote(c.BaseURL() + c.OriginalURL())}
+	parts = append(parts, headers...)
+	if len(body) > 0 {
+		parts = append(parts, "--data-raw", shellQuote(string(body)))
+	}
+	return strings.Join(parts, " ")
+}
+
+// shellQuote wraps a value in single quotes so it is passed verbatim by POSIX shells
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
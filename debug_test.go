@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestCurlCommand(t *testing.T) {
+	var got string
+	app := fiber.New()
+	app.Post("/api/timeseries", func(c *fiber.Ctx) error {
+		var filter FilterRequest
+		if err := c.BodyParser(&filter); err != nil {
+			return err
+		}
+		response, err := dryRunResponse(c, "SELECT 1", nil, FilterRequest{LocationKey: filter.LocationKey})
+		got, _ = response["curl"].(string)
+		return err
+	})
+	req := httptest.NewRequest(fiber.MethodPost, "/api/timeseries?pretty=true", strings.NewReader("LocationKey=US"))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationForm)
+	req.Header.Set("X-API-Key", "secret")
+	if _, err := app.Test(req); err != nil {
+		t.Fatal(err)
+	}
+
+	// The form request is reproduced with its filter as JSON, and credentials are redacted
+	for _, want := range []string{
+		"curl -X POST 'http://example.com/api/timeseries?pretty=true'",
+		"-H 'Content-Type: application/json'",
+		"-H 'X-Api-Key: REDACTED'",
+		`--data-raw '{"location_key":"US",`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("curl command lacks %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, fiber.MIMEApplicationForm) || strings.Contains(got, "secret") {
+		t.Errorf("curl command keeps the form content type or the key:\n%s", got)
+	}
+}
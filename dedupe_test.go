@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/gofiber/fiber/v2"
+)
+
+// dedupeApp serves the read routes whose dedupe handling is tested
+func dedupeApp() *fiber.App {
+	app := fiber.New()
+	api := app.Group("/api", negotiateSchema)
+	api.Post("/timeseries", getTimeSeries)
+	api.Post("/aggregate", getAggregate)
+	api.Post("/excess", getExcess)
+	api.Post("/forecast", getForecast)
+	return app
+}
+
+// postV2 sends body to path as a schema version 2 request and returns the decoded envelope
+func postV2(t *testing.T, app *fiber.App, path, body string) (int, map[string]json.RawMessage) {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodPost, path, strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Header.Set(schemaVersionHeader, "2")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := io.ReadAll(resp.Body)
+	var out map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &out); err != nil {
+		t.Fatalf("%s: response %s: %v", path, raw, err)
+	}
+	return resp.StatusCode, out
+}
+
+// collapsedDuplicates returns meta.collapsed_duplicates of a version 2 response, or -1
+func collapsedDuplicates(t *testing.T, out map[string]json.RawMessage) int {
+	t.Helper()
+	var meta struct {
+		CollapsedDuplicates *int `json:"collapsed_duplicates"`
+	}
+	json.Unmarshal(out["meta"], &meta)
+	if meta.CollapsedDuplicates == nil {
+		return -1
+	}
+	return *meta.CollapsedDuplicates
+}
+
+// TestDedupeDuplicateCount checks that in debug mode a deduplicated read reports exactly
+// the duplicates ClickHouse counted, and reads through the collapsing source
+func TestDedupeDuplicateCount(t *testing.T) {
+	defer func(debug, dedupe bool) { cfg.Debug, cfg.DedupeReads = debug, dedupe }(cfg.Debug, cfg.DedupeReads)
+	cfg.Debug, cfg.DedupeReads = true, false
+	assumeTableNotEmpty(t)
+	date := time.Date(2021, 3, 5, 0, 0, 0, 0, time.UTC)
+	confirmed := int32(5)
+	routes := []struct {
+		path, body string
+		row        []any
+	}{
+		{"/api/timeseries", `{"location_keys": ["US", "FR"], "fields": ["new_confirmed"]%s}`, []any{"US", date, &confirmed}},
+		{"/api/excess", `{"location_key": "US", "metric": "new_confirmed", "baseline_start": "2021-01-01",
+			"baseline_end": "2021-01-31", "start_date": "2021-03-01", "end_date": "2021-03-31"%s}`, []any{"US", date, int32(5), 4.0}},
+	}
+	for _, route := range routes {
+		for _, dedupe := range []bool{true, false} {
+			t.Run(fmt.Sprintf("%s dedupe %v", route.path, dedupe), func(t *testing.T) {
+				stub := useStubConn(t, func(query string, args ...any) driver.Row {
+					if strings.Contains(query, "uniqExact(location_key, date)") {
+						return stubRow{values: []any{uint64(4)}}
+					}
+					return stubRow{err: fmt.Errorf("not stubbed")}
+				})
+				stub.query = func(query string, args ...any) [][]any { return [][]any{route.row} }
+
+				body := fmt.Sprintf(route.body, "")
+				if dedupe {
+					body = fmt.Sprintf(route.body, `, "dedupe": true`)
+				}
+				status, out := postV2(t, dedupeApp(), route.path, body)
+				if status != fiber.StatusOK {
+					t.Fatalf("status %d: %s", status, out["error"])
+				}
+				want := -1
+				if dedupe {
+					want = 4
+				}
+				if got := collapsedDuplicates(t, out); got != want {
+					t.Errorf("collapsed_duplicates = %d, want %d", got, want)
+				}
+				read := stub.queries[len(stub.queries)-1]
+				if got := strings.Contains(read, "LIMIT 1 BY location_key, date"); got != dedupe {
+					t.Errorf("read collapses duplicates = %v, want %v:\n%s", got, dedupe, read)
+				}
+			})
+		}
+	}
+}
+
+// dedupeFixture is the ground truth of TestDedupeOnClickHouse: two locations over two weeks
+// with one row per day, each updated at dedupeUpdated
+func dedupeFixture() [][]any {
+	var rows [][]any
+	for l, key := range []string{"US", "FR"} {
+		cumulative := int32(0)
+		for day := 1; day <= 14; day++ {
+			confirmed := int32(10*day + l)
+			cumulative += confirmed
+			rows = append(rows, []any{key, time.Date(2021, 3, day, 0, 0, 0, 0, time.UTC), confirmed, cumulative, dedupeUpdated})
+		}
+	}
+	return rows
+}
+
+// dedupeUpdated is when the fixture's true rows were stored; stale duplicates are older
+var dedupeUpdated = time.Date(2021, 3, 20, 0, 0, 0, 0, time.UTC)
+
+// dedupeDuplicates are the extra rows of the duplicated table: stale revisions of three US
+// days with wrong values, and an exact copy of the latest FR row
+func dedupeDuplicates() [][]any {
+	stale := dedupeUpdated.Add(-72 * time.Hour)
+	var rows [][]any
+	for _, day := range []int{1, 5, 14} {
+		rows = append(rows, []any{"US", time.Date(2021, 3, day, 0, 0, 0, 0, time.UTC), int32(999), int32(99999), stale})
+	}
+	truth := dedupeFixture()
+	return append(rows, truth[len(truth)-1])
+}
+
+// createDedupeTable creates a covid19 table in a new database holding rows, and returns
+// a connection using that database
+func createDedupeTable(t *testing.T, database string, rows [][]any) clickhouse.Conn {
+	t.Helper()
+	ctx := context.Background()
+	admin := testClickhouse(t)
+	for _, statement := range []string{
+		"DROP DATABASE IF EXISTS " + database,
+		"CREATE DATABASE " + database,
+		"CREATE TABLE " + database + `.covid19 (
+			location_key String, date Date,
+			new_confirmed Int32, new_deceased Int32, new_recovered Int32, new_tested Int32,
+			cumulative_confirmed Int32, cumulative_deceased Int32, cumulative_recovered Int32, cumulative_tested Int32,
+			updated_at DateTime
+		) ENGINE = MergeTree ORDER BY (location_key, date)`,
+	} {
+		if err := admin.Exec(ctx, statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { admin.Exec(context.Background(), "DROP DATABASE IF EXISTS "+database) })
+
+	batch, err := admin.PrepareBatch(ctx, "INSERT INTO "+database+".covid19 (location_key, date, new_confirmed, cumulative_confirmed, updated_at)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err := batch.Append(row...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := batch.Send(); err != nil {
+		t.Fatal(err)
+	}
+	return testClickhouseDatabase(t, database)
+}
+
+// TestDedupeOnClickHouse checks, against the ClickHouse at CLICKHOUSE_TEST_ADDR, that every
+// deduplicated read of a table with deliberate duplicates returns exactly what the same read
+// returns from the table without them, and that debug mode counts the duplicates exactly
+func TestDedupeOnClickHouse(t *testing.T) {
+	defer func(debug, dedupe bool) { cfg.Debug, cfg.DedupeReads = debug, dedupe }(cfg.Debug, cfg.DedupeReads)
+	cfg.Debug, cfg.DedupeReads = true, false
+	suffix := fmt.Sprint(os.Getpid())
+	truth := createDedupeTable(t, "dedupe_truth_"+suffix, dedupeFixture())
+	duplicated := createDedupeTable(t, "dedupe_duplicated_"+suffix, append(dedupeFixture(), dedupeDuplicates()...))
+
+	requests := []struct {
+		path, body string
+		duplicates int // collapsed_duplicates expected in the duplicated table
+	}{
+		{"/api/timeseries", `{"location_keys": ["US", "FR"], "dedupe": true}`, 4},
+		{"/api/timeseries", `{"location_keys": ["US", "FR"], "top_k": 3, "top_metric": "new_confirmed", "dedupe": true}`, 4},
+		{"/api/aggregate", `{"location_keys": ["US", "FR"], "metric": "new_confirmed", "dedupe": true}`, -1},
+		{"/api/excess", `{"location_key": "US", "metric": "new_confirmed", "baseline_start": "2021-03-01",
+			"baseline_end": "2021-03-07", "start_date": "2021-03-08", "end_date": "2021-03-14", "dedupe": true}`, 3},
+		{"/api/forecast", `{"location_key": "US", "window": 14, "horizon": 3, "dedupe": true}`, -1},
+	}
+	app := dedupeApp()
+	read := func(conn clickhouse.Conn, path, body string) (string, int) {
+		old := db
+		db = conn
+		defer func() { db = old }()
+		if err := loadTableSchema(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		status, out := postV2(t, app, path, body)
+		if status != fiber.StatusOK {
+			t.Fatalf("%s: status %d: %s", path, status, out["error"])
+		}
+		return string(out["data"]), collapsedDuplicates(t, out)
+	}
+	for _, r := range requests {
+		want, _ := read(truth, r.path, r.body)
+		got, duplicates := read(duplicated, r.path, r.body)
+		if got != want {
+			t.Errorf("%s %s: deduplicated data differs from the ground truth:\n%s\n%s", r.path, r.body, got, want)
+		}
+		if duplicates != r.duplicates {
+			t.Errorf("%s %s: collapsed_duplicates = %d, want %d", r.path, r.body, duplicates, r.duplicates)
+		}
+		// The fixture only proves something if the duplicates change the raw result
+		if raw, _ := read(duplicated, r.path, strings.Replace(r.body, `"dedupe": true`, `"dedupe": false`, 1)); raw == want {
+			t.Errorf("%s %s: the duplicates do not affect the result without dedupe", r.path, r.body)
+		}
+	}
+}
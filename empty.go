@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Responses for empty results while covid19 has no rows, see EMPTY_TABLE_BEHAVIOR
+const (
+	emptyTableWarn        = "warn"        // 200 with the empty result and a warning
+	emptyTableUnavailable = "unavailable" // 503 with Retry-After until data is ingested
+)
+
+// normalizeEmptyTableBehavior validates EMPTY_TABLE_BEHAVIOR, defaulting to warn
+func normalizeEmptyTableBehavior(behavior string) string {
+	if behavior == emptyTableUnavailable {
+		return behavior
+	}
+	return emptyTableWarn
+}
+
+// emptyTableCheckInterval bounds how often an empty result triggers an emptiness check
+const emptyTableCheckInterval = time.Minute
+
+// emptyTable caches the last emptiness check of covid19
+var emptyTable struct {
+	sync.Mutex
+	checked time.Time
+	empty   bool
+}
+
+// tableIsEmpty reports whether covid19 has no rows, checking at most once per interval.
+// A failed check counts as not empty, so the request's own result is returned.
+func tableIsEmpty(c *fiber.Ctx) bool {
+	emptyTable.Lock()
+	defer emptyTable.Unlock()
+	if time.Since(emptyTable.checked) < emptyTableCheckInterval {
+		return emptyTable.empty
+	}
+	var rows uint8
+	err := db.QueryRow(c.UserContext(), "SELECT count() FROM (SELECT 1 FROM covid19 LIMIT 1)").Scan(&rows)
+	if err != nil {
+		return false
+	}
+	emptyTable.checked, emptyTable.empty = time.Now(), rows == 0
+	return emptyTable.empty
+}
+
+// respondEmptyTable answers an empty result on an empty table per EMPTY_TABLE_BEHAVIOR.
+// It returns false when the response should be sent as usual (after adding the warning).
+func respondEmptyTable(c *fiber.Ctx) (bool, error) {
+	if !tableIsEmpty(c) {
+		return false, nil
+	}
+	if cfg.EmptyTableBehavior == emptyTableUnavailable {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(emptyTableCheckInterval.Seconds())))
+		return true, c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "No data has been ingested yet"})
+	}
+	addWarning(c, "the covid19 table has no rows yet")
+	return false, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/gofiber/fiber/v2"
+)
+
+// seedTable makes the emptiness check of covid19 find rows rows, forgetting earlier checks
+func seedTable(t *testing.T, rows uint8) *stubConn {
+	t.Helper()
+	emptyTable.Lock()
+	emptyTable.checked = time.Time{}
+	emptyTable.Unlock()
+	t.Cleanup(func() {
+		emptyTable.Lock()
+		emptyTable.checked = time.Time{}
+		emptyTable.Unlock()
+	})
+	return useStubConn(t, func(query string, args ...any) driver.Row {
+		return stubRow{values: []any{rows}}
+	})
+}
+
+// emptyResult serves an empty list through respond with the given schema version
+func emptyResult(t *testing.T, version string) (int, fiber.Map, string) {
+	t.Helper()
+	app := fiber.New()
+	app.Get("/", negotiateSchema, func(c *fiber.Ctx) error {
+		return respond(c, []LocationName{})
+	})
+	req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+	req.Header.Set(schemaVersionHeader, version)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	headers := fiber.Map{"X-Warning": resp.Header.Get("X-Warning"), "Retry-After": resp.Header.Get("Retry-After")}
+	return resp.StatusCode, headers, string(body)
+}
+
+func TestEmptyTable(t *testing.T) {
+	defer func(old string) { cfg.EmptyTableBehavior = old }(cfg.EmptyTableBehavior)
+	tests := []struct {
+		name       string
+		behavior   string
+		rows       uint8
+		version    string
+		status     int
+		warning    string
+		retryAfter string
+		body       string
+	}{
+		{"warn v1", emptyTableWarn, 0, "1", 200, "the covid19 table has no rows yet", "", `[]`},
+		{"warn v2", emptyTableWarn, 0, "2", 200, "the covid19 table has no rows yet", "",
+			`{"schema_version":2,"data":[],"meta":{"count":0,"warnings":["the covid19 table has no rows yet"]}}`},
+		{"unavailable", emptyTableUnavailable, 0, "2", 503, "", "60", `{"error":"No data has been ingested yet"}`},
+		{"no match on a seeded table", emptyTableUnavailable, 1, "2", 200, "", "", `{"schema_version":2,"data":[],"meta":{"count":0}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.EmptyTableBehavior = tt.behavior
+			stub := seedTable(t, tt.rows)
+			status, headers, body := emptyResult(t, tt.version)
+			if status != tt.status || headers["X-Warning"] != tt.warning || headers["Retry-After"] != tt.retryAfter {
+				t.Errorf("status %d, headers %v; want %d, warning %q, Retry-After %q", status, headers, tt.status, tt.warning, tt.retryAfter)
+			}
+			if body != tt.body {
+				t.Errorf("body = %s, want %s", body, tt.body)
+			}
+			if len(stub.queries) != 1 || !strings.Contains(stub.queries[0], "FROM covid19") {
+				t.Errorf("emptiness checks = %q, want one of covid19", stub.queries)
+			}
+
+			// The check is cached, so a second empty result does not query again
+			emptyResult(t, tt.version)
+			if len(stub.queries) != 1 {
+				t.Errorf("%d emptiness checks within the interval, want 1", len(stub.queries))
+			}
+		})
+	}
+}
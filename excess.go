@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ExcessRequest selects a metric, a comparison window (start_date..end_date) and an earlier baseline window
+type ExcessRequest struct {
+	FilterRequest
+	Metric        string `json:"metric"`         // Required: metric column to compare
+	BaselineStart string `json:"baseline_start"` // Required: first day of the baseline window
+	BaselineEnd   string `json:"baseline_end"`   // Required: last day of the baseline window
+}
+
+// ExcessData compares one day's value with its location's baseline average
+type ExcessData struct {
+	Date        Date     `json:"date"`
+	LocationKey string   `json:"location_key"`
+	Value       int32    `json:"value"`
+	Baseline    float64  `json:"baseline"`
+	Excess      float64  `json:"excess"`
+	Ratio       *float64 `json:"ratio"` // null when the baseline average is zero
+}
+
+// validate checks the metric and both windows; the baseline must end before the comparison starts
+func (r ExcessRequest) validate() error {
+	if !isMetricColumn(r.Metric) {
+		return fmt.Errorf("unknown metric %q", r.Metric)
+	}
+	_, baselineEnd, err := parseDateRange("baseline_start", r.BaselineStart, "baseline_end", r.BaselineEnd)
+	if err != nil {
+		return err
+	}
+	start, _, err := parseDateRange("start_date", r.StartDate, "end_date", r.EndDate)
+	if err != nil {
+		return err
+	}
+	if !baselineEnd.Before(start) {
+		return errors.New("baseline window must end before start_date")
+	}
+	return nil
+}
+
+// getExcess handles POST /api/excess. For every location the baseline is the plain
+// average of the metric's daily values over baseline_start..baseline_end (days without
+// a row are not counted). Each day in start_date..end_date is then reported with
+// excess = value - baseline and ratio = value / baseline.
+func getExcess(c *fiber.Ctx) error {
+	var req ExcessRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid filter parameters"})
+	}
+	if err := req.validate(); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	keys, err := req.locationKeys()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(keys) == 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "location_key or location_keys is required"})
+	}
+	format, err := resolveDateFormat(c, req.DateFormat)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	location, locationArg := locationCondition(keys)
+	reads, readArgs, err := req.readConditions(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	conditions := append([]string{location}, reads...)
+	sourceArgs := append([]interface{}{locationArg}, readArgs...)
+
+	dedupe := req.dedupe()
+	if dedupe && cfg.Debug {
+		duplicates, err := countDuplicates(c.UserContext(), conditions, sourceArgs)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Query execution failed: " + err.Error()})
+		}
+		addMeta(c, "collapsed_duplicates", duplicates)
+	}
+
+	recordUsageFilter(c, keys, req.StartDate, req.EndDate)
+	clampDateRange(c, req.StartDate, req.EndDate)
+
+	source := readSource(conditions, dedupe)
+	query := `
+	WITH baseline AS (
+		SELECT location_key, avg(` + req.Metric + `) AS baseline
+		FROM ` + source + `
+		WHERE date BETWEEN ? AND ?
+		GROUP BY location_key
+	),
+	current AS (
+		SELECT location_key, date, ` + req.Metric + ` AS value
+		FROM ` + source + `
+		WHERE date BETWEEN ? AND ?
+	)
+	SELECT c.location_key, c.date, c.value, b.baseline
+	FROM current AS c
+	INNER JOIN baseline AS b ON b.location_key = c.location_key
+	ORDER BY c.location_key, c.date
+	`
+	var args []interface{}
+	args = append(append(args, sourceArgs...), req.BaselineStart, req.BaselineEnd)
+	args = append(append(args, sourceArgs...), req.StartDate, req.EndDate)
+
+	rows, err := db.Query(c.UserContext(), query, args...)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Query execution failed: " + err.Error()})
+	}
+	defer rows.Close()
+
+	data := []ExcessData{}
+	for rows.Next() {
+		e := ExcessData{Date: Date{format: format}}
+		if err := rows.Scan(&e.LocationKey, &e.Date.Time, &e.Value, &e.Baseline); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Row scan failed: " + err.Error()})
+		}
+		e.Excess = round(float64(e.Value) - e.Baseline)
+		if e.Baseline != 0 {
+			ratio := round(float64(e.Value) / e.Baseline)
+			e.Ratio = &ratio
+		}
+		e.Baseline = round(e.Baseline)
+		data = append(data, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading rows"})
+	}
+
+	return respond(c, data)
+}
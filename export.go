@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Output formats of /api/timeseries besides the default JSON rows
+const (
+	outputCSV      = "csv"      // text/csv with a header row
+	outputColumnar = "columnar" // {"columns": [...], "values": [[...], ...]}, one array per column
+)
+
+// keyColumns are always returned; fields may position them explicitly
+var keyColumns = []string{"location_key", "date"}
+
+// outputColumns returns the exported columns in the order of the request's fields list.
+// Key columns not named in fields come first, and computed columns not named are appended.
+func outputColumns(fields []string, selected []string) []string {
+	named := map[string]bool{}
+	for _, field := range fields {
+		named[field] = true
+	}
+	var columns []string
+	for _, key := range keyColumns {
+		if !named[key] {
+			columns = append(columns, key)
+		}
+	}
+	seen := map[string]bool{}
+	for _, field := range fields {
+		if !seen[field] {
+			seen[field] = true
+			columns = append(columns, field)
+		}
+	}
+	for _, column := range selected {
+		if !seen[column] && !containsString(keyColumns, column) {
+			seen[column] = true
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldValue returns the value of the named column, as held by ts
+func (ts *TimeSeriesData) fieldValue(column string) interface{} {
+	switch column {
+	case "location_key":
+		return ts.LocationKey
+	case "date":
+		return ts.Date
+	case "positivity":
+		return ts.Positivity
+	case "updated_at":
+		return ts.UpdatedAt
+	case "days_since_first_case":
+		return ts.DaysSinceFirstCase
+	case "decreasing_columns":
+		return ts.DecreasingColumns
+	case "new_confirmed_sum":
+		return ts.NewConfirmedSum
+	case "new_deceased_sum":
+		return ts.NewDeceasedSum
+	case "new_recovered_sum":
+		return ts.NewRecoveredSum
+	case "new_tested_sum":
+		return ts.NewTestedSum
+	}
+	// Metric columns share scanDest's pointers
+	if dest, ok := ts.scanDest([]string{column})[0].(**int32); ok {
+		return *dest
+	}
+	return nil
+}
+
+// csvValue renders a field value as CSV text; missing values are empty
+func csvValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case Date:
+		return v.String()
+	case *int32:
+		if v != nil {
+			return strconv.FormatInt(int64(*v), 10)
+		}
+	case []string:
+		return strings.Join(v, ";")
+	case **int32:
+		if v != nil {
+			return csvValue(*v)
+		}
+	case *int64:
+		if v != nil {
+			return strconv.FormatInt(*v, 10)
+		}
+	case **int64:
+		if v != nil {
+			return csvValue(*v)
+		}
+	case *float64:
+		if v != nil {
+			return strconv.FormatFloat(*v, 'f', -1, 64)
+		}
+	case *time.Time:
+		if v != nil {
+			return v.Format(time.RFC3339)
+		}
+	}
+	return ""
+}
+
+// streamCSV runs query and streams its rows as a CSV attachment with columns in the given
+// order. Rows are written in batches of STREAM_BATCH_SIZE; after each batch the output is
+// flushed to the connection, so memory stays bounded by one batch and a slow client slows
+// the read down instead of the server buffering ahead of it. A flush still blocked after
+// STREAM_WRITE_TIMEOUT fails, which ends the response and cancels the query.
+func streamCSV(c *fiber.Ctx, query string, args []interface{}, scanned, columns []string, format dateFormat) error {
+	// The query outlives the handler (and QUERY_TIMEOUT), so it gets its own cancellation
+	ctx, cancel := context.WithCancel(context.WithoutCancel(c.UserContext()))
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		cancel()
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Query execution failed: " + err.Error()})
+	}
+
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="timeseries.csv"`)
+	conn := c.Context().Conn()
+	header := aliasedNames(c, columns)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+		defer rows.Close()
+		defer conn.SetWriteDeadline(time.Time{})
+
+		// Buffered output can reach the connection on any write, so the deadline is kept
+		// STREAM_WRITE_TIMEOUT ahead of the latest row, refreshed at most once a second
+		var refreshed time.Time
+		extendDeadline := func() {
+			if now := time.Now(); now.Sub(refreshed) >= time.Second {
+				conn.SetWriteDeadline(now.Add(cfg.StreamWriteTimeout))
+				refreshed = now
+			}
+		}
+		out := csv.NewWriter(w)
+		flush := func() bool {
+			extendDeadline()
+			out.Flush()
+			return out.Error() == nil && w.Flush() == nil
+		}
+		if out.Write(header) != nil || !flush() {
+			return
+		}
+		record := make([]string, len(columns))
+		for n := 1; rows.Next(); n++ {
+			extendDeadline()
+			ts := TimeSeriesData{Date: Date{format: format}}
+			if err := rows.Scan(ts.scanDest(scanned)...); err != nil {
+				logContextf(ctx, "CSV stream stopped: %v", err)
+				return
+			}
+			roundPtr(ts.Positivity)
+			for j, column := range columns {
+				record[j] = csvValue(ts.fieldValue(column))
+			}
+			if out.Write(record) != nil {
+				return
+			}
+			if n%cfg.StreamBatchSize == 0 && !flush() {
+				return
+			}
+		}
+		if err := rows.Err(); err != nil {
+			logContextf(ctx, "CSV stream stopped: %v", err)
+			return
+		}
+		flush()
+	})
+	return nil
+}
+
+// columnarData holds one array of values per column, in the order of columns
+type columnarData struct {
+	Columns []string        `json:"columns"`
+	Values  [][]interface{} `json:"values"`
+}
+
+// toColumnar pivots rows into per-column arrays
+func toColumnar(rows []TimeSeriesData, columns []string) columnarData {
+	out := columnarData{Columns: columns, Values: make([][]interface{}, len(columns))}
+	for j, column := range columns {
+		values := make([]interface{}, len(rows))
+		for i := range rows {
+			values[i] = rows[i].fieldValue(column)
+		}
+		out.Values[j] = values
+	}
+	return out
+}
+
+// validateOutput checks the requested output format
+func validateOutput(format string) error {
+	switch format {
+	case "", "json", outputCSV, outputColumnar:
+		return nil
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+// respondTimeSeries writes timeseries rows in the requested output format; CSV is
+// streamed by streamCSV instead
+func respondTimeSeries(c *fiber.Ctx, filter FilterRequest, data []TimeSeriesData, selected []string) error {
+	switch filter.Format {
+	case outputColumnar:
+		return respond(c, toColumnar(data, outputColumns(filter.Fields, selected)))
+	}
+	return respond(c, timeSeriesRows(data))
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestOutputColumns(t *testing.T) {
+	selected := []string{"new_confirmed", "cumulative_confirmed", "positivity"}
+	tests := []struct {
+		name     string
+		fields   []string
+		selected []string
+		want     []string
+	}{
+		{"no fields", nil, selected, []string{"location_key", "date", "new_confirmed", "cumulative_confirmed", "positivity"}},
+		{"fields order kept", []string{"cumulative_confirmed", "new_confirmed"}, selected[:2],
+			[]string{"location_key", "date", "cumulative_confirmed", "new_confirmed"}},
+		{"keys positioned by fields", []string{"new_confirmed", "date", "location_key"}, selected[:1],
+			[]string{"new_confirmed", "date", "location_key"}},
+		{"one key named", []string{"date", "new_confirmed"}, selected[:1], []string{"location_key", "date", "new_confirmed"}},
+		{"unnamed computed columns appended", []string{"cumulative_confirmed"}, selected,
+			[]string{"location_key", "date", "cumulative_confirmed", "new_confirmed", "positivity"}},
+		{"duplicates dropped", []string{"new_confirmed", "new_confirmed", "date"}, selected[:1],
+			[]string{"location_key", "new_confirmed", "date"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := outputColumns(tt.fields, tt.selected); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("outputColumns(%v, %v) = %v, want %v", tt.fields, tt.selected, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestStreamCSVGolden locks the CSV download in each date format, with a missing metric and
+// a negative correction among the rows
+func TestStreamCSVGolden(t *testing.T) {
+	assumeTableNotEmpty(t)
+	for _, format := range []dateFormat{dateFormatDate, dateFormatRFC3339, dateFormatEpochDays} {
+		t.Run(string(format), func(t *testing.T) {
+			stub := useStubConn(t, func(query string, args ...any) driver.Row { return stubRow{err: errors.New("not stubbed")} })
+			stub.query = func(query string, args ...any) [][]any {
+				confirmed, correction, deceased := int32(4388), int32(-2), int32(17)
+				return [][]any{
+					{"US_CA", time.Date(2021, 3, 5, 0, 0, 0, 0, time.UTC), &confirmed, &deceased},
+					{"FR", time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC), &correction, (*int32)(nil)},
+				}
+			}
+			app := fiber.New()
+			app.Post("/api/timeseries", negotiateSchema, getTimeSeries)
+			body := fmt.Sprintf(`{"location_keys": ["US_CA", "FR"], "fields": ["new_confirmed", "new_deceased"], "format": "csv", "date_format": %q}`, format)
+			req := httptest.NewRequest(fiber.MethodPost, "/api/timeseries", strings.NewReader(body))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			req.Header.Set(schemaVersionHeader, "2")
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != fiber.StatusOK || !strings.HasPrefix(resp.Header.Get(fiber.HeaderContentType), "text/csv") {
+				t.Fatalf("status %d, Content-Type %q: %s", resp.StatusCode, resp.Header.Get(fiber.HeaderContentType), got)
+			}
+			checkGolden(t, "timeseries_csv_"+string(format)+".golden", got)
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// forecastCaveat is returned with every forecast so it is never mistaken for a projection model
+const forecastCaveat = "Naive log-linear extrapolation of recent new_confirmed. It assumes the recent " +
+	"growth rate continues unchanged and ignores interventions, reporting artifacts and saturation. " +
+	"Not suitable for planning decisions."
+
+// ForecastRequest selects a location, how far ahead to project and how much history to fit
+type ForecastRequest struct {
+	LocationKey string `json:"location_key"`     // Required: location to forecast
+	Horizon     int    `json:"horizon"`          // Optional: days to project, default 14
+	Window      int    `json:"window"`           // Optional: most recent days used to fit the trend, default 28
+	Interval    bool   `json:"interval"`         // Optional: include a ~95% interval
+	AsOf        string `json:"as_of,omitempty"`  // Optional: see /api/timeseries
+	Dedupe      *bool  `json:"dedupe,omitempty"` // Optional: see /api/timeseries
+	DateFormat  string `json:"date_format,omitempty"`
+}
+
+// ForecastPoint is one projected day
+type ForecastPoint struct {
+	Date  Date     `json:"date"`
+	Value float64  `json:"value"`
+	Lower *float64 `json:"lower,omitempty"`
+	Upper *float64 `json:"upper,omitempty"`
+}
+
+// ForecastResponse labels the projection with the model that produced it
+type ForecastResponse struct {
+	LocationKey string          `json:"location_key"`
+	Metric      string          `json:"metric"`
+	Model       string          `json:"model"`
+	Caveat      string          `json:"caveat"`
+	Window      int             `json:"window"`
+	HistoryEnd  Date            `json:"history_end"`
+	Forecast    []ForecastPoint `json:"forecast"`
+}
+
+// getForecast handles POST /api/forecast.
+//
+// Model: over the last `window` days, fit ordinary least squares to
+// log(1 + new_confirmed) against day index (negative daily values, which are
+// corrections, count as zero). The fitted line is extended `horizon` days and
+// transformed back with exp(y) - 1. The optional interval is the fitted value
+// ± 1.96 residual standard errors in log space; it only reflects scatter around
+// the trend, not uncertainty in the trend itself, so it is too narrow far out.
+func getForecast(c *fiber.Ctx) error {
+	req := ForecastRequest{Horizon: 14, Window: 28}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid filter parameters"})
+	}
+	if req.LocationKey == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "location_key is required"})
+	}
+	if req.Horizon < 1 || req.Horizon > cfg.MaxForecastHorizon {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("horizon must be between 1 and %d", cfg.MaxForecastHorizon)})
+	}
+	if req.Window < 7 || req.Window > 365 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "window must be between 7 and 365"})
+	}
+	format, err := resolveDateFormat(c, req.DateFormat)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	filter := FilterRequest{LocationKey: req.LocationKey, AsOf: req.AsOf, Dedupe: req.Dedupe}
+	reads, readArgs, err := filter.readConditions(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	recordUsageFilter(c, []interface{}{req.LocationKey}, "", "")
+
+	args := append(append([]interface{}{req.LocationKey}, readArgs...), req.Window)
+	rows, err := db.Query(c.UserContext(), forecastQuery(filter, reads), args...)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Query execution failed: " + err.Error()})
+	}
+	defer rows.Close()
+
+	var dates []time.Time
+	var values []float64
+	for rows.Next() {
+		var date time.Time
+		var value int32
+		if err := rows.Scan(&date, &value); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Row scan failed: " + err.Error()})
+		}
+		dates = append(dates, date)
+		values = append(values, math.Log1p(math.Max(float64(value), 0)))
+	}
+	if err := rows.Err(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading rows"})
+	}
+	if len(values) < 7 {
+		return c.Status(http.StatusUnprocessableEntity).JSON(fiber.Map{"error": "Not enough history to forecast this location"})
+	}
+
+	// Rows arrive newest first; fit on day offsets from the latest date
+	last := dates[0]
+	xs := make([]float64, len(dates))
+	for i, d := range dates {
+		xs[i] = -last.Sub(d).Hours() / 24
+	}
+	slope, intercept, stderr := fitLine(xs, values)
+
+	resp := ForecastResponse{
+		LocationKey: req.LocationKey,
+		Metric:      "new_confirmed",
+		Model:       "log-linear",
+		Caveat:      forecastCaveat,
+		Window:      len(values),
+		HistoryEnd:  Date{Time: last, format: format},
+	}
+	for day := 1; day <= req.Horizon; day++ {
+		y := intercept + slope*float64(day)
+		point := ForecastPoint{
+			Date:  Date{Time: last.AddDate(0, 0, day), format: format},
+			Value: round(math.Expm1(y)),
+		}
+		if req.Interval {
+			lower, upper := round(math.Max(math.Expm1(y-1.96*stderr), 0)), round(math.Expm1(y+1.96*stderr))
+			point.Lower, point.Upper = &lower, &upper
+		}
+		resp.Forecast = append(resp.Forecast, point)
+	}
+	return respond(c, resp)
+}
+
+// fitLine returns the least squares slope and intercept of ys against xs and the
+// residual standard error
+func fitLine(xs, ys []float64) (slope, intercept, stderr float64) {
+	n := float64(len(xs))
+	var sumX, sumY float64
+	for i := range xs {
+		sumX += xs[i]
+		sumY += ys[i]
+	}
+	meanX, meanY := sumX/n, sumY/n
+	var sxx, sxy float64
+	for i := range xs {
+		sxx += (xs[i] - meanX) * (xs[i] - meanX)
+		sxy += (xs[i] - meanX) * (ys[i] - meanY)
+	}
+	if sxx != 0 {
+		slope = sxy / sxx
+	}
+	intercept = meanY - slope*meanX
+
+	var ssr float64
+	for i := range xs {
+		r := ys[i] - (intercept + slope*xs[i])
+		ssr += r * r
+	}
+	if n > 2 {
+		stderr = math.Sqrt(ssr / (n - 2))
+	}
+	return slope, intercept, stderr
+}
+
+// forecastQuery reads the latest window days of the location's new_confirmed, newest
+// first. Its arguments are the location key, the reads arguments and the window.
+func forecastQuery(filter FilterRequest, reads []string) string {
+	conditions := append([]string{"location_key = ?"}, reads...)
+	return `
+	SELECT date, new_confirmed
+	FROM ` + readSource(conditions, filter.dedupe()) + `
+	ORDER BY date DESC
+	LIMIT ?
+	`
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestForecastQueryHonoursDedupe(t *testing.T) {
+	yes, no := true, false
+	collapse := "LIMIT 1 BY location_key, date"
+	tests := []struct {
+		name        string
+		dedupe      *bool
+		dedupeReads bool
+		want        bool
+	}{
+		{"request enables", &yes, false, true},
+		{"request disables", &no, true, false},
+		{"DEDUPE_READS default on", nil, true, true},
+		{"DEDUPE_READS default off", nil, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(old bool) { cfg.DedupeReads = old }(cfg.DedupeReads)
+			cfg.DedupeReads = tt.dedupeReads
+			query := forecastQuery(FilterRequest{LocationKey: "US_CA", Dedupe: tt.dedupe}, []string{"date <= today()"})
+			if got := strings.Contains(query, collapse); got != tt.want {
+				t.Errorf("duplicates collapsed = %v, want %v\n%s", got, tt.want, query)
+			}
+			// The window limit applies to the rows read, deduplicated or not
+			source := readSource([]string{"location_key = ?", "date <= today()"}, tt.want)
+			if !strings.Contains(query, "FROM "+source+"\n\tORDER BY date DESC\n\tLIMIT ?") {
+				t.Errorf("window limit is not applied to the rows of %s\n%s", source, query)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// Handling of rows dated after today, see FUTURE_ROWS
+const (
+	futureExclude = "exclude" // leave them out of reads
+	futureInclude = "include" // read them like any other row
+)
+
+// normalizeFutureRows validates FUTURE_ROWS, defaulting to exclude
+func normalizeFutureRows(behavior string) string {
+	if behavior == futureInclude {
+		return behavior
+	}
+	return futureExclude
+}
+
+// futureConditions keeps reads to rows dated today or earlier, so a mistakenly ingested
+// future date cannot become a location's latest row. ?include_future=true reads them
+// anyway, for debugging, with a warning.
+func futureConditions(c *fiber.Ctx) []string {
+	if cfg.FutureRows == futureInclude {
+		return nil
+	}
+	if c.QueryBool("include_future") {
+		addWarning(c, "include_future: rows dated after today are included")
+		return nil
+	}
+	return []string{"date <= today()"}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/gofiber/fiber/v2"
+)
+
+// GroupsRequest defines ad-hoc location groups whose series are summed
+type GroupsRequest struct {
+	Groups     map[string][]string `json:"groups"`     // Required: group name → location keys
+	StartDate  string              `json:"start_date"` // Required
+	EndDate    string              `json:"end_date"`   // Required
+	Fields     []string            `json:"fields,omitempty"`
+	AsOf       string              `json:"as_of,omitempty"`
+	Dedupe     *bool               `json:"dedupe,omitempty"`
+	DateFormat string              `json:"date_format,omitempty"`
+}
+
+// GroupSeriesData is one group's summed metrics for a day
+type GroupSeriesData struct {
+	Group     string           `json:"group"`
+	Date      Date             `json:"date"`
+	Locations uint64           `json:"locations"` // group members with a row that day
+	Values    map[string]int64 `json:"values"`
+}
+
+// filter returns the request's shared filters in FilterRequest form
+func (r GroupsRequest) filter() FilterRequest {
+	return FilterRequest{StartDate: r.StartDate, EndDate: r.EndDate, Fields: r.Fields, AsOf: r.AsOf, Dedupe: r.Dedupe, DateFormat: r.DateFormat}
+}
+
+// validate checks the date range and the group caps, returning the group names in order
+// and every distinct location key
+func (r GroupsRequest) validate() ([]string, []interface{}, error) {
+	if _, _, err := parseDateRange("start_date", r.StartDate, "end_date", r.EndDate); err != nil {
+		return nil, nil, err
+	}
+	if len(r.Groups) == 0 {
+		return nil, nil, errors.New("groups must define at least one group")
+	}
+	if len(r.Groups) > cfg.MaxLocationGroups {
+		return nil, nil, fmt.Errorf("too many groups: %d (maximum %d)", len(r.Groups), cfg.MaxLocationGroups)
+	}
+	names := make([]string, 0, len(r.Groups))
+	var keys []interface{}
+	seen := map[string]bool{}
+	for name, members := range r.Groups {
+		if name == "" || len(members) == 0 {
+			return nil, nil, errors.New("every group needs a name and at least one location key")
+		}
+		names = append(names, name)
+		for _, key := range members {
+			if key != "" && !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	if len(keys) > cfg.MaxLocationKeys {
+		return nil, nil, fmt.Errorf("too many location keys: %d (maximum %d)", len(keys), cfg.MaxLocationKeys)
+	}
+	sort.Strings(names)
+	return names, keys, nil
+}
+
+// getGroups handles POST /api/groups, summing each group's member series per day. A
+// location may belong to several groups. Unknown location keys are rejected, so a typo
+// does not silently shrink a group.
+func getGroups(c *fiber.Ctx) error {
+	var req GroupsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid filter parameters"})
+	}
+	names, keys, err := req.validate()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	filter := req.filter()
+	columns, err := resolveFields(req.Fields)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	format, err := resolveDateFormat(c, req.DateFormat)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	reads, readArgs, err := filter.readConditions(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	recordUsageFilter(c, keys, req.StartDate, req.EndDate)
+	clampDateRange(c, req.StartDate, req.EndDate)
+
+	unknown, err := unknownLocations(c, keys)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Query execution failed: " + err.Error()})
+	}
+	// Before the first ingest every key is unknown; answer like the other endpoints do
+	if len(unknown) > 0 && !tableIsEmpty(c) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Unknown location keys", "location_keys": unknown})
+	}
+
+	sums := make([]string, len(columns))
+	for i, column := range columns {
+		sums[i] = "sum(" + column + ") AS " + column
+	}
+	dedupe := filter.dedupe()
+	var parts []string
+	var args []interface{}
+	for _, name := range names {
+		members := make([]interface{}, len(req.Groups[name]))
+		for i, key := range req.Groups[name] {
+			members[i] = key
+		}
+		conditions := append([]string{"location_key IN ?", "date BETWEEN ? AND ?"}, reads...)
+		parts = append(parts, `
+		SELECT ? AS group_name, date, uniqExact(location_key) AS locations, `+join(sums, ", ")+`
+		FROM `+readSource(conditions, dedupe)+`
+		GROUP BY date`)
+		args = append(args, name, clickhouse.GroupSet{Value: members}, req.StartDate, req.EndDate)
+		args = append(args, readArgs...)
+	}
+	query := `
+	SELECT * FROM (` + join(parts, "\n\t\tUNION ALL") + `
+	)
+	ORDER BY group_name, date`
+
+	rows, err := db.Query(c.UserContext(), query, args...)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Query execution failed: " + err.Error()})
+	}
+	defer rows.Close()
+
+	data := []GroupSeriesData{}
+	for rows.Next() {
+		g := GroupSeriesData{Date: Date{format: format}, Values: make(map[string]int64, len(columns))}
+		values := make([]int64, len(columns))
+		dest := []interface{}{&g.Group, &g.Date.Time, &g.Locations}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Row scan failed: " + err.Error()})
+		}
+		for i, column := range columns {
+			g.Values[column] = values[i]
+		}
+		data = append(data, g)
+	}
+
+	if err := rows.Err(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading rows"})
+	}
+
+	return respond(c, data)
+}
+
+// unknownLocations returns the keys that have no row in covid19
+func unknownLocations(c *fiber.Ctx, keys []interface{}) ([]string, error) {
+	rows, err := db.Query(c.UserContext(), "SELECT DISTINCT location_key FROM covid19 WHERE location_key IN ?", clickhouse.GroupSet{Value: keys})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	known := map[string]bool{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		known[key] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	var unknown []string
+	for _, key := range keys {
+		if !known[key.(string)] {
+			unknown = append(unknown, key.(string))
+		}
+	}
+	return unknown, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxGrowthFactorWindow bounds the prior period a growth factor is measured against
+const maxGrowthFactorWindow = 90
+
+// GrowthFactorRequest selects the locations, days and prior period of the growth factor
+type GrowthFactorRequest struct {
+	FilterRequest
+	Window int `json:"window"` // Optional: days averaged before each date, default GROWTH_FACTOR_WINDOW
+}
+
+// GrowthFactorData is one day's new_confirmed relative to the average of the days before it
+type GrowthFactorData struct {
+	LocationKey  string   `json:"location_key"`
+	Date         Date     `json:"date"`
+	NewConfirmed int32    `json:"new_confirmed"`
+	PriorDays    uint64   `json:"prior_days"`    // days with a row in the prior window; fewer than window after gaps
+	PriorAverage *float64 `json:"prior_average"` // null without prior rows
+	GrowthFactor *float64 `json:"growth_factor"` // new_confirmed / prior_average; null when the average is zero or missing
+}
+
+// getGrowthFactor handles POST /api/growth-factor. For every day of start_date..end_date
+// the growth factor is new_confirmed divided by the average new_confirmed of the window
+// calendar days before it (the day itself excluded); above 1 spread is speeding up, below
+// 1 slowing down. The prior window reaches back before start_date, so the first days of
+// the range are complete.
+func getGrowthFactor(c *fiber.Ctx) error {
+	req := GrowthFactorRequest{Window: cfg.GrowthFactorWindow}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid filter parameters"})
+	}
+	start, _, err := parseDateRange("start_date", req.StartDate, "end_date", req.EndDate)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if req.Window < 1 || req.Window > maxGrowthFactorWindow {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("window must be between 1 and %d", maxGrowthFactorWindow)})
+	}
+	keys, err := req.locationKeys()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	format, err := resolveDateFormat(c, req.DateFormat)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	reads, readArgs, err := req.readConditions(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	recordUsageFilter(c, keys, req.StartDate, req.EndDate)
+	clampDateRange(c, req.StartDate, req.EndDate)
+
+	// The window is read from the days before start_date too
+	conditions := []string{"date BETWEEN ? AND ?"}
+	args := []interface{}{start.AddDate(0, 0, -req.Window).Format(time.DateOnly), req.EndDate}
+	if len(keys) > 0 {
+		condition, arg := locationCondition(keys)
+		conditions = append(conditions, condition)
+		args = append(args, arg)
+	}
+	conditions = append(conditions, reads...)
+	args = append(args, readArgs...)
+	args = append(args, req.StartDate)
+
+	// A RANGE frame over the date counts calendar days, so a gap shortens the window
+	// instead of reaching further back
+	query := fmt.Sprintf(`
+	SELECT location_key, date, new_confirmed, prior_days, prior_average
+	FROM (
+		SELECT location_key, date, new_confirmed,
+			   count() OVER prior AS prior_days,
+			   avg(new_confirmed) OVER prior AS prior_average
+		FROM %s
+		WINDOW prior AS (PARTITION BY location_key ORDER BY date RANGE BETWEEN %d PRECEDING AND 1 PRECEDING)
+	)
+	WHERE date >= ?
+	ORDER BY location_key, date`, readSource(conditions, req.dedupe()), req.Window)
+
+	rows, err := db.Query(c.UserContext(), query, args...)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Query execution failed: " + err.Error()})
+	}
+	defer rows.Close()
+
+	data := []GrowthFactorData{}
+	for rows.Next() {
+		g := GrowthFactorData{Date: Date{format: format}}
+		var average float64
+		if err := rows.Scan(&g.LocationKey, &g.Date.Time, &g.NewConfirmed, &g.PriorDays, &average); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Row scan failed: " + err.Error()})
+		}
+		if g.PriorDays > 0 {
+			rounded := round(average)
+			g.PriorAverage = &rounded
+			if average != 0 {
+				factor := round(float64(g.NewConfirmed) / average)
+				g.GrowthFactor = &factor
+			}
+		}
+		data = append(data, g)
+	}
+
+	if err := rows.Err(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading rows"})
+	}
+
+	return respond(c, data)
+}
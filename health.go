@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// background tracks long-running goroutines so shutdown can wait for them
+var background sync.WaitGroup
+
+// shutdown is done once the process is asked to terminate. Goroutines a request leaves
+// running use it instead of the request's context, which ends with the response.
+var shutdown = context.Background()
+
+// startPingLoop pings ClickHouse every PING_INTERVAL until ctx is done, keeping pooled
+// connections warm and updating the covid19_clickhouse_up gauge
+func startPingLoop(ctx context.Context) {
+	if cfg.PingInterval <= 0 {
+		return
+	}
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		ticker := time.NewTicker(cfg.PingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				pingClickhouse(ctx)
+			}
+		}
+	}()
+}
+
+// pingClickhouse runs a single bounded ping and records the outcome
+func pingClickhouse(ctx context.Context) {
+	pingCtx, cancel := context.WithTimeout(ctx, cfg.PingTimeout)
+	defer cancel()
+	if err := db.Ping(pingCtx); err != nil {
+		if ctx.Err() == nil {
+			log.Printf("ClickHouse ping failed: %v", err)
+		}
+		clickhouseUp.Set(0)
+		return
+	}
+	clickhouseUp.Set(1)
+}
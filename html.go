@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// htmlTable pages list results as an HTML table for browsers
+var htmlTable = template.Must(template.New("table").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Path}}</title>
+<style>
+body { font-family: sans-serif; margin: 1em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 2px 6px; text-align: left; }
+th { background: #f3f3f3; }
+td.num { text-align: right; }
+</style>
+</head>
+<body>
+<h1>{{.Path}}</h1>
+<p>Rows {{.First}}–{{.Last}} of {{.Total}}{{with .Prev}} · {{template "pager" .}}{{end}}{{with .Next}} · {{template "pager" .}}{{end}}</p>
+<table>
+<tr>{{range .Columns}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr>{{range .}}<td{{if .Numeric}} class="num"{{end}}>{{.Text}}</td>{{end}}</tr>
+{{end}}</table>
+</body>
+</html>
+{{define "pager"}}{{if .Fields}}<form method="post" action="{{.URL}}" style="display: inline">
+{{- range .Fields}}<input type="hidden" name="{{.Name}}" value="{{.Value}}">{{end -}}
+<button type="submit">{{.Label}}</button></form>{{else}}<a href="{{.URL}}">{{.Label}}</a>{{end}}{{end}}
+`))
+
+// htmlBodyField is the form field a pager form carries a JSON request body in; see
+// restorePagedBody
+const htmlBodyField = "html_page_body"
+
+// htmlPager links to another page of the request. A GET request is a plain link; a
+// request with a body, as the POST routes take their filters, is re-sent as a form
+// carrying the original body, so the next page keeps the filter.
+type htmlPager struct {
+	Label  string
+	URL    string
+	Fields []htmlField
+}
+
+// htmlField is one hidden form field of a pager
+type htmlField struct {
+	Name  string
+	Value string
+}
+
+// htmlCell is one rendered value
+type htmlCell struct {
+	Text    string
+	Numeric bool
+}
+
+// wantsHTML reports whether the client prefers text/html over JSON, as browsers do
+func wantsHTML(c *fiber.Ctx) bool {
+	return c.Accepts(fiber.MIMEApplicationJSON, fiber.MIMETextHTML) == fiber.MIMETextHTML
+}
+
+// respondHTML renders a slice of structs as a table, one column per JSON field. Fields
+// empty in every row (unselected metrics) are left out. The page and page_size query
+// parameters select the rows shown; page_size is capped by MAX_HTML_ROWS.
+func respondHTML(c *fiber.Ctx, rows reflect.Value) error {
+	pageSize := c.QueryInt("page_size", 100)
+	if pageSize <= 0 || pageSize > cfg.MaxHTMLRows {
+		pageSize = cfg.MaxHTMLRows
+	}
+	page := max(c.QueryInt("page", 1), 1)
+	total := rows.Len()
+	first := min((page-1)*pageSize, total)
+	last := min(first+pageSize, total)
+
+	var columns []string
+	var cells [][]htmlCell
+	if total > 0 {
+		var fields []int
+		columns, fields = htmlColumns(rows.Type().Elem(), rows, first, last)
+		columns = aliasedNames(c, columns)
+		for i := first; i < last; i++ {
+			row := make([]htmlCell, len(fields))
+			for j, field := range fields {
+				row[j] = htmlValue(rows.Index(i).Field(field).Interface())
+			}
+			cells = append(cells, row)
+		}
+	}
+
+	view := fiber.Map{
+		"Path": c.Path(), "Columns": columns, "Rows": cells,
+		"First": min(first+1, total), "Last": last, "Total": total,
+	}
+	if page > 1 {
+		view["Prev"] = htmlPager{Label: "previous", URL: pageURL(c, page-1, pageSize), Fields: pagerFields(c)}
+	}
+	if last < total {
+		view["Next"] = htmlPager{Label: "next", URL: pageURL(c, page+1, pageSize), Fields: pagerFields(c)}
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return htmlTable.Execute(c.Response().BodyWriter(), view)
+}
+
+// htmlColumns returns the JSON names and field indexes of the struct fields shown
+func htmlColumns(t reflect.Type, rows reflect.Value, first, last int) ([]string, []int) {
+	var names []string
+	var fields []int
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" || field.Anonymous {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		shown := field.Type.Kind() != reflect.Pointer
+		for r := first; r < last && !shown; r++ {
+			shown = !rows.Index(r).Field(i).IsNil()
+		}
+		if shown {
+			names = append(names, name)
+			fields = append(fields, i)
+		}
+	}
+	return names, fields
+}
+
+// htmlValue renders a field as its JSON value, with strings unquoted and null empty
+func htmlValue(v interface{}) htmlCell {
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" {
+		return htmlCell{}
+	}
+	if text, err := strconv.Unquote(string(data)); err == nil {
+		return htmlCell{Text: text}
+	}
+	_, err = strconv.ParseFloat(string(data), 64)
+	return htmlCell{Text: string(data), Numeric: err == nil}
+}
+
+// pageURL links to another page of the same request
+func pageURL(c *fiber.Ctx, page, pageSize int) string {
+	query := url.Values{}
+	c.Context().QueryArgs().VisitAll(func(key, value []byte) {
+		query.Add(string(key), string(value))
+	})
+	query.Set("page", strconv.Itoa(page))
+	query.Set("page_size", strconv.Itoa(pageSize))
+	return c.Path() + "?" + query.Encode()
+}
+
+// pagerFields returns the hidden fields re-sending the request body: form fields as they
+// were, any other body (JSON) whole in htmlBodyField. Nil for requests without a body.
+func pagerFields(c *fiber.Ctx) []htmlField {
+	body := c.Body()
+	if len(body) == 0 {
+		return nil
+	}
+	if !strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEApplicationForm) {
+		return []htmlField{{Name: htmlBodyField, Value: string(body)}}
+	}
+	var fields []htmlField
+	c.Request().PostArgs().VisitAll(func(key, value []byte) {
+		fields = append(fields, htmlField{Name: string(key), Value: string(value)})
+	})
+	return fields
+}
+
+// restorePagedBody turns a pager form carrying htmlBodyField back into the JSON request
+// it came from, so handlers parse the page's filter like the original request's
+func restorePagedBody(c *fiber.Ctx) error {
+	if !strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEApplicationForm) {
+		return c.Next()
+	}
+	if body := c.Request().PostArgs().Peek(htmlBodyField); body != nil {
+		c.Request().SetBody(append([]byte(nil), body...))
+		c.Request().Header.SetContentType(fiber.MIMEApplicationJSON)
+	}
+	return c.Next()
+}
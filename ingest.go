@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxIngestErrorSamples bounds how many failed lines are echoed back
+const maxIngestErrorSamples = 10
+
+// ingestError describes a line that could not be ingested
+type ingestError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// validateIngest checks the fields every stored row needs
+func validateIngest(ts TimeSeriesData) error {
+	if ts.LocationKey == "" {
+		return errors.New("location_key is required")
+	}
+	if ts.Date.IsZero() {
+		return errors.New("date is required")
+	}
+	return nil
+}
+
+// ingestRow is one ingested object: the stored columns of TimeSeriesData, plus the fields
+// computedFields names captured so they are refused rather than silently dropped
+type ingestRow struct {
+	TimeSeriesData
+	Positivity         json.RawMessage `json:"positivity"`
+	UpdatedAt          json.RawMessage `json:"updated_at"`
+	DaysSinceFirstCase json.RawMessage `json:"days_since_first_case"`
+	DecreasingColumns  json.RawMessage `json:"decreasing_columns"`
+	NewConfirmedSum    json.RawMessage `json:"new_confirmed_sum"`
+	NewDeceasedSum     json.RawMessage `json:"new_deceased_sum"`
+	NewRecoveredSum    json.RawMessage `json:"new_recovered_sum"`
+	NewTestedSum       json.RawMessage `json:"new_tested_sum"`
+}
+
+// validate rejects computed fields, even null ones, and checks the stored row
+func (r ingestRow) validate() error {
+	v := reflect.ValueOf(r)
+	for i := 1; i < v.NumField(); i++ {
+		if v.Field(i).Len() > 0 {
+			name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+			return fmt.Errorf("%s is computed by the API and cannot be ingested", name)
+		}
+	}
+	return validateIngest(r.TimeSeriesData)
+}
+
+// ingestNDJSON handles POST /api/admin/ingest with an application/x-ndjson body.
+// Bad lines are counted and sampled; with ?strict=true any bad line rejects the
+// whole upload before anything is written.
+func ingestNDJSON(c *fiber.Ctx) error {
+	if !strings.HasPrefix(c.Get(fiber.HeaderContentType), "application/x-ndjson") {
+		return c.Status(http.StatusUnsupportedMediaType).JSON(fiber.Map{"error": "Content-Type must be application/x-ndjson"})
+	}
+	strict := c.QueryBool("strict", false)
+
+	var body io.Reader = bytes.NewReader(c.Body())
+	if strings.EqualFold(c.Get(fiber.HeaderContentEncoding), "gzip") {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid gzip body"})
+		}
+		defer gz.Close()
+		// Bound the decompressed size as well as the compressed one
+		body = io.LimitReader(gz, int64(cfg.IngestBodyLimit)+1)
+	}
+
+	// Ingestion is bounded by the body size rather than QUERY_TIMEOUT
+	ctx := context.WithoutCancel(c.UserContext())
+	writer := newTimeSeriesWriter()
+	var pending []TimeSeriesData
+	var samples []ingestError
+	failed := 0
+
+	reader := bufio.NewReader(body)
+	total := 0
+	for line := 1; ; line++ {
+		raw, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Failed to read body: " + readErr.Error()})
+		}
+		total += len(raw)
+		if total > cfg.IngestBodyLimit {
+			return c.Status(http.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": "Decoded body too large"})
+		}
+
+		if raw = bytes.TrimSpace(raw); len(raw) > 0 {
+			ts, err := decodeIngestLine(raw)
+			if err != nil {
+				failed++
+				if len(samples) < maxIngestErrorSamples {
+					samples = append(samples, ingestError{Line: line, Error: err.Error()})
+				}
+				if strict {
+					return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid line", "line": line, "detail": err.Error()})
+				}
+			} else if strict {
+				pending = append(pending, ts)
+			} else if err := writer.addTimeSeries(ctx, ts); err != nil {
+				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Insert failed: " + err.Error(), "inserted": writer.Written()})
+			}
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+	}
+
+	for _, ts := range pending {
+		if err := writer.addTimeSeries(ctx, ts); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Insert failed: " + err.Error(), "inserted": writer.Written()})
+		}
+	}
+	if err := writer.Flush(ctx); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Insert failed: " + err.Error(), "inserted": writer.Written()})
+	}
+
+	return sendJSON(c, fiber.Map{
+		"inserted": writer.Written(),
+		"failed":   failed,
+		"errors":   samples,
+	})
+}
+
+// decodeIngestLine decodes and validates a single NDJSON line, which must hold exactly one object
+func decodeIngestLine(raw []byte) (TimeSeriesData, error) {
+	var row ingestRow
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&row); err != nil {
+		return row.TimeSeriesData, err
+	}
+	if dec.More() {
+		return row.TimeSeriesData, errors.New("unexpected data after the object")
+	}
+	return row.TimeSeriesData, row.validate()
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ingest posts body to ingestNDJSON and returns the status, the decoded response and the
+// rows written
+func ingest(t *testing.T, query, body string) (int, fiber.Map, [][]any) {
+	t.Helper()
+	stub := useStubConn(t, func(query string, args ...any) driver.Row { return stubRow{} })
+	stub.writes = true
+	app := fiber.New()
+	app.Post("/", ingestNDJSON)
+	req := httptest.NewRequest(fiber.MethodPost, "/"+query, strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, "application/x-ndjson")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := io.ReadAll(resp.Body)
+	var out fiber.Map
+	if err := json.Unmarshal(raw, &out); err != nil {
+		t.Fatalf("response %s: %v", raw, err)
+	}
+	return resp.StatusCode, out, stub.appended
+}
+
+func TestIngestNDJSON(t *testing.T) {
+	body := `{"location_key": "US", "date": "2021-03-05", "new_confirmed": 5}
+{"location_key": "FR", "date": "2021-03-05", "positivity": 0.1}
+
+{"location_key": "DE", "date": "2021-03-05", "nope": 1}
+{"location_key": "IT", "date": "2021-03-05T00:00:00Z"}
+{"date": "2021-03-05"}
+{"location_key": "ES", "date": "2021-03-05"} {"location_key": "PT", "date": "2021-03-05"}
+`
+	status, out, rows := ingest(t, "", body)
+	if status != fiber.StatusOK || out["inserted"] != 2.0 || out["failed"] != 4.0 || len(rows) != 2 {
+		t.Fatalf("status %d, response %v, %d rows written; want 2 inserted and 4 failed", status, out, len(rows))
+	}
+	got, _ := json.Marshal(out["errors"])
+	want := `[{"error":"positivity is computed by the API and cannot be ingested","line":2},` +
+		`{"error":"json: unknown field \"nope\"","line":4},{"error":"location_key is required","line":6},` +
+		`{"error":"unexpected data after the object","line":7}]`
+	if string(got) != want {
+		t.Errorf("errors = %s, want %s", got, want)
+	}
+
+	status, out, rows = ingest(t, "?strict=true", body)
+	if status != fiber.StatusBadRequest || out["line"] != 2.0 || len(rows) != 0 {
+		t.Errorf("strict: status %d, response %v, %d rows written; want 400 at line 2 and no rows", status, out, len(rows))
+	}
+}
+
+func TestIngestMalformedJSON(t *testing.T) {
+	body := `{"location_key": "US", "date": "2021-03-05"}
+{"location_key": "FR", "date": "2021-03-05"}
+{"location_key": "DE", "date": 
+{"location_key": "IT", "date": "2021-03-05"}
+{"location_key": "ES",, "date": "2021-03-05"}
+{"location_key": "PT", "date": "2021-03-05"}`
+
+	// A malformed line is counted like any bad line; the lines after it are still read
+	status, out, rows := ingest(t, "", body)
+	if status != fiber.StatusOK || out["inserted"] != 4.0 || out["failed"] != 2.0 || len(rows) != 4 {
+		t.Fatalf("status %d, response %v, %d rows written; want 4 inserted and 2 failed", status, out, len(rows))
+	}
+	var lines []any
+	for _, sample := range out["errors"].([]any) {
+		lines = append(lines, sample.(map[string]any)["line"])
+	}
+	if fmt.Sprint(lines) != "[3 5]" {
+		t.Errorf("sampled lines %v, want [3 5]", lines)
+	}
+	keys := fmt.Sprintln(rows[0][0], rows[1][0], rows[2][0], rows[3][0])
+	if keys != "US FR IT PT\n" {
+		t.Errorf("inserted %q, want US FR IT PT", keys)
+	}
+
+	status, out, rows = ingest(t, "?strict=true", body)
+	if status != fiber.StatusBadRequest || out["line"] != 3.0 || len(rows) != 0 {
+		t.Errorf("strict: status %d, response %v, %d rows written; want 400 at line 3 and no rows", status, out, len(rows))
+	}
+}
+
+func TestIngestRejectsComputedFields(t *testing.T) {
+	for _, field := range computedFields {
+		line := fmt.Sprintf(`{"location_key": "US", "date": "2021-03-05", %q: null}`, field)
+		want := field + " is computed by the API and cannot be ingested"
+		if _, err := decodeIngestLine([]byte(line)); err == nil || err.Error() != want {
+			t.Errorf("%s: decodeIngestLine = %v, want %q", field, err, want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// integritySample is one offending row of a check
+type integritySample struct {
+	LocationKey string    `json:"location_key"`
+	Date        time.Time `json:"date"`
+	Detail      string    `json:"detail,omitempty"`
+}
+
+// integrityResult reports one check of an integrity run
+type integrityResult struct {
+	Check       string            `json:"check"`
+	Description string            `json:"description"`
+	Violations  uint64            `json:"violations"`
+	Samples     []integritySample `json:"samples"`
+	Error       string            `json:"error,omitempty"`
+}
+
+// getIntegrityCheck handles GET /api/integrity-check (admin). It runs the consistency
+// checks concurrently (all of them, or those named in ?checks=a,b), each bounded by
+// INTEGRITY_CHECK_TIMEOUT, and reports the violation count with up to
+// INTEGRITY_SAMPLE_SIZE offending rows per check. See consistencyChecks for what
+// each check detects.
+func getIntegrityCheck(c *fiber.Ctx) error {
+	checks := consistencyChecks
+	if names := c.Query("checks"); names != "" {
+		wanted := map[string]bool{}
+		for _, name := range splitList(names) {
+			wanted[name] = true
+		}
+		checks = nil
+		for _, check := range consistencyChecks {
+			if wanted[check.Name] {
+				checks = append(checks, check)
+				delete(wanted, check.Name)
+			}
+		}
+		for name := range wanted {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Unknown check " + name})
+		}
+	}
+
+	results := make([]integrityResult, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check consistencyCheck) {
+			defer wg.Done()
+			results[i] = runIntegrityCheck(c.UserContext(), check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	return sendJSON(c, results)
+}
+
+// runIntegrityCheck counts and samples the violations of one check within its time budget
+func runIntegrityCheck(parent context.Context, check consistencyCheck) integrityResult {
+	ctx, cancel := context.WithTimeout(parent, cfg.IntegrityCheckTimeout)
+	defer cancel()
+
+	result := integrityResult{Check: check.Name, Description: check.Description, Samples: []integritySample{}}
+	count, err := check.countViolations(ctx)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Violations = count
+	if count == 0 {
+		return result
+	}
+
+	query := "SELECT location_key, date, detail FROM (" + check.Violations + ") ORDER BY location_key, date LIMIT ?"
+	rows, err := db.Query(ctx, query, append(check.args(), cfg.IntegritySampleSize)...)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sample integritySample
+		if err := rows.Scan(&sample.LocationKey, &sample.Date, &sample.Detail); err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		result.Samples = append(result.Samples, sample)
+	}
+	if err := rows.Err(); err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
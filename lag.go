@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// lagPercentiles are the percentiles of reporting lag returned by /api/reporting-lag
+var lagPercentiles = []int{50, 75, 90, 95, 99}
+
+// ReportingLagRequest selects the rows whose reporting lag is summarized
+type ReportingLagRequest struct {
+	FilterRequest
+	PerLocation bool `json:"per_location"` // Optional: one summary per location instead of a single global one
+}
+
+// ReportingLagData summarizes, in days, how long after their date rows were first ingested
+type ReportingLagData struct {
+	LocationKey string           `json:"location_key,omitempty"` // omitted for the global summary
+	Rows        uint64           `json:"rows"`                   // (location_key, date) rows measured
+	Min         int64            `json:"min"`
+	Max         int64            `json:"max"`
+	Mean        float64          `json:"mean"`
+	Percentiles map[string]int64 `json:"percentiles"` // "p50", "p90", ... of the lag in days
+}
+
+// validate checks the optional date range
+func (r ReportingLagRequest) validate() error {
+	if r.StartDate != "" || r.EndDate != "" {
+		if _, _, err := parseDateRange("start_date", r.StartDate, "end_date", r.EndDate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getReportingLag handles POST /api/reporting-lag. The lag of a (location_key, date) row
+// is the number of days between its date and the day its first revision was ingested
+// (UPDATED_AT_COLUMN); later revisions do not count as reporting. Without that column the
+// lag cannot be measured and an empty list is returned with a warning.
+func getReportingLag(c *fiber.Ctx) error {
+	var req ReportingLagRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid filter parameters"})
+	}
+	if err := req.validate(); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	keys, err := req.locationKeys()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !tableHasColumn(cfg.UpdatedAtColumn) {
+		addWarning(c, "reporting lag unavailable: the covid19 table has no ingestion timestamp")
+		return respond(c, []ReportingLagData{})
+	}
+	reads, readArgs, err := req.readConditions(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	recordUsageFilter(c, keys, req.StartDate, req.EndDate)
+	clampDateRange(c, req.StartDate, req.EndDate)
+
+	var conditions []string
+	var args []interface{}
+	if len(keys) > 0 {
+		condition, arg := locationCondition(keys)
+		conditions = append(conditions, condition)
+		args = append(args, arg)
+	}
+	if req.StartDate != "" {
+		conditions = append(conditions, "date BETWEEN ? AND ?")
+		args = append(args, req.StartDate, req.EndDate)
+	}
+	conditions = append(conditions, reads...)
+	args = append(args, readArgs...)
+
+	levels := make([]string, len(lagPercentiles))
+	for i, p := range lagPercentiles {
+		levels[i] = fmt.Sprintf("%g", float64(p)/100)
+	}
+	selects, groupBy := "", ""
+	if req.PerLocation {
+		selects, groupBy = "location_key, ", "\n\tGROUP BY location_key\n\tORDER BY location_key"
+	}
+	query := `
+	SELECT ` + selects + `count() AS rows, min(lag), max(lag), avg(lag),
+		   quantilesExact(` + strings.Join(levels, ", ") + `)(lag)
+	FROM (
+		SELECT location_key, toInt64(dateDiff('day', date, toDate(min(` + quoteIdentifier(cfg.UpdatedAtColumn) + `)))) AS lag
+		FROM ` + readSource(conditions, false) + `
+		GROUP BY location_key, date
+	)` + groupBy
+
+	rows, err := db.Query(c.UserContext(), query, args...)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Query execution failed: " + err.Error()})
+	}
+	defer rows.Close()
+
+	data := []ReportingLagData{}
+	for rows.Next() {
+		var d ReportingLagData
+		var quantiles []int64
+		dest := []interface{}{&d.Rows, &d.Min, &d.Max, &d.Mean, &quantiles}
+		if req.PerLocation {
+			dest = append([]interface{}{&d.LocationKey}, dest...)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Row scan failed: " + err.Error()})
+		}
+		if d.Rows == 0 {
+			continue // the global summary over no rows
+		}
+		d.Mean = round(d.Mean)
+		d.Percentiles = make(map[string]int64, len(lagPercentiles))
+		for i, p := range lagPercentiles {
+			d.Percentiles[fmt.Sprintf("p%d", p)] = quantiles[i]
+		}
+		data = append(data, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading rows"})
+	}
+
+	return respond(c, data)
+}
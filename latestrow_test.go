@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// latestRowFilter reads the latest row of every location, the request the strategies
+// differ on most
+var latestRowFilter = FilterRequest{Fields: []string{"new_confirmed", "cumulative_confirmed"}}
+
+// latestRows runs filter's query under strategy on conn and returns its rows as JSON,
+// ordered by location
+func latestRows(tb testing.TB, conn clickhouse.Conn, strategy string, filter FilterRequest) string {
+	tb.Helper()
+	defer func(old string) { cfg.LatestRowStrategy = old }(cfg.LatestRowStrategy)
+	cfg.LatestRowStrategy = strategy
+	q, err := newTimeSeriesQuery(filter)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	query, args := q.build()
+	rows, err := conn.Query(context.Background(), query+"\n\tORDER BY location_key", args...)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer rows.Close()
+	var data []TimeSeriesData
+	for rows.Next() {
+		var ts TimeSeriesData
+		if err := rows.Scan(ts.scanDest(q.selectColumns())...); err != nil {
+			tb.Fatal(err)
+		}
+		data = append(data, ts)
+	}
+	if err := rows.Err(); err != nil {
+		tb.Fatal(err)
+	}
+	out, _ := json.Marshal(data)
+	return string(out)
+}
+
+// TestLatestRowStrategiesOnClickHouse checks that LIMIT 1 BY and the window function
+// return identical rows from the covid19 table at CLICKHOUSE_TEST_ADDR, with and without
+// a date range
+func TestLatestRowStrategiesOnClickHouse(t *testing.T) {
+	conn := testClickhouse(t)
+	ranged := latestRowFilter
+	ranged.StartDate, ranged.EndDate = "2021-01-01", "2021-12-31"
+	for name, filter := range map[string]FilterRequest{"all dates": latestRowFilter, "date range": ranged} {
+		window := latestRows(t, conn, latestRowWindow, filter)
+		if limitBy := latestRows(t, conn, latestRowLimitBy, filter); limitBy != window {
+			t.Errorf("%s: LIMIT 1 BY rows differ from the window function's:\n%s\n%s", name, limitBy, window)
+		}
+	}
+}
+
+// BenchmarkLatestRowStrategies times the latest-row read under each LATEST_ROW_STRATEGY
+// against the covid19 table at CLICKHOUSE_TEST_ADDR
+func BenchmarkLatestRowStrategies(b *testing.B) {
+	conn := testClickhouse(b)
+	for _, strategy := range []string{latestRowWindow, latestRowLimitBy} {
+		b.Run(strategy, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				latestRows(b, conn, strategy, latestRowFilter)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// locationKeySeparator joins the levels of a location_key
+const locationKeySeparator = "_"
+
+// locationLevel is the SQL for a row's level in the key hierarchy: its number of separators
+const locationLevel = "(length(location_key) - length(replaceAll(location_key, '" + locationKeySeparator + "', '')))"
+
+// LocationKeyLevel describes one level of the location_key hierarchy
+type LocationKeyLevel struct {
+	Level       int    `json:"level"` // number of separators in keys of this level
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Example     string `json:"example"`
+	Locations   uint64 `json:"locations"` // keys of this level in METADATA_TABLE
+}
+
+// LocationName maps a top-level location_key to its human-readable name
+type LocationName struct {
+	LocationKey string `json:"location_key"`
+	Name        string `json:"name"`
+}
+
+// LocationKeyDictionary documents how location_key values are built
+type LocationKeyDictionary struct {
+	Separator string             `json:"separator"`
+	Levels    []LocationKeyLevel `json:"levels"`
+	Countries []LocationName     `json:"countries"`
+}
+
+// locationKeyLevels are the static descriptions of the key hierarchy, most general first
+var locationKeyLevels = []LocationKeyLevel{
+	{Level: 0, Name: "country", Description: "ISO 3166-1 alpha-2 country code", Example: "US"},
+	{Level: 1, Name: "subregion1", Description: "Country key, then the first-level subdivision code (ISO 3166-2 where one exists)", Example: "US_CA"},
+	{Level: 2, Name: "subregion2", Description: "Subregion1 key, then the second-level subdivision code (e.g. US county FIPS)", Example: "US_CA_06037"},
+	{Level: 3, Name: "locality", Description: "Parent key, then a locality code for cities and metropolitan areas", Example: "US_CA_SFO"},
+}
+
+// getLocationKeys handles GET /api/location-keys. The level descriptions are static; the
+// number of keys per level and the country names come from METADATA_TABLE.
+func getLocationKeys(c *fiber.Ctx) error {
+	levels := make([]LocationKeyLevel, len(locationKeyLevels))
+	copy(levels, locationKeyLevels)
+
+	metadata := quoteIdentifier(cfg.MetadataTable)
+	rows, err := db.Query(c.UserContext(), `
+	SELECT `+locationLevel+` AS level, uniqExact(location_key)
+	FROM `+metadata+`
+	GROUP BY level`)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Query execution failed: " + err.Error()})
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var level int64
+		var locations uint64
+		if err := rows.Scan(&level, &locations); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Row scan failed: " + err.Error()})
+		}
+		if level >= 0 && level < int64(len(levels)) {
+			levels[level].Locations = locations
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading rows"})
+	}
+
+	rows, err = db.Query(c.UserContext(), `
+	SELECT location_key, ifNull(name, '')
+	FROM `+keyedSource(cfg.MetadataTable, "any("+quoteIdentifier(cfg.MetadataNameColumn)+") AS name")+`
+	WHERE `+locationLevel+` = 0
+	ORDER BY location_key`)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Query execution failed: " + err.Error()})
+	}
+	defer rows.Close()
+
+	countries := []LocationName{}
+	for rows.Next() {
+		var country LocationName
+		if err := rows.Scan(&country.LocationKey, &country.Name); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Row scan failed: " + err.Error()})
+		}
+		countries = append(countries, country)
+	}
+
+	if err := rows.Err(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading rows"})
+	}
+
+	warnDuplicateKeys(c, cfg.MetadataTable)
+	return respond(c, LocationKeyDictionary{Separator: locationKeySeparator, Levels: levels, Countries: countries})
+}
@@ -5,65 +5,223 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
 	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// TimeSeriesData is one covid19 row. Metric fields are nil (and omitted) when not selected.
 type TimeSeriesData struct {
-	Date                time.Time `json:"date"`
-	LocationKey         string    `json:"location_key"`
-	NewConfirmed        int32     `json:"new_confirmed"`
-	NewDeceased         int32     `json:"new_deceased"`
-	NewRecovered        int32     `json:"new_recovered"`
-	NewTested           int32     `json:"new_tested"`
-	CumulativeConfirmed int32     `json:"cumulative_confirmed"`
-	CumulativeDeceased  int32     `json:"cumulative_deceased"`
-	CumulativeRecovered int32     `json:"cumulative_recovered"`
-	CumulativeTested    int32     `json:"cumulative_tested"`
+	Date                Date       `json:"date"`
+	LocationKey         string     `json:"location_key"`
+	NewConfirmed        *int32     `json:"new_confirmed,omitempty"`
+	NewDeceased         *int32     `json:"new_deceased,omitempty"`
+	NewRecovered        *int32     `json:"new_recovered,omitempty"`
+	NewTested           *int32     `json:"new_tested,omitempty"`
+	CumulativeConfirmed *int32     `json:"cumulative_confirmed,omitempty"`
+	CumulativeDeceased  *int32     `json:"cumulative_deceased,omitempty"`
+	CumulativeRecovered *int32     `json:"cumulative_recovered,omitempty"`
+	CumulativeTested    *int32     `json:"cumulative_tested,omitempty"`
+	Positivity          *float64   `json:"positivity,omitempty"`            // Set when requested; see TESTED_UNIT
+	UpdatedAt           *time.Time `json:"updated_at,omitempty"`            // Set when requested and the table records it
+	DaysSinceFirstCase  **int32    `json:"days_since_first_case,omitempty"` // Set when requested; null before the location's first case
+	DecreasingColumns   []string   `json:"decreasing_columns,omitempty"`    // Set with monotonicity=flag: cumulative columns lower than the day before
+	NewConfirmedSum     **int64    `json:"new_confirmed_sum,omitempty"`     // Set with moving_sum_days: trailing sum, null before a full window
+	NewDeceasedSum      **int64    `json:"new_deceased_sum,omitempty"`
+	NewRecoveredSum     **int64    `json:"new_recovered_sum,omitempty"`
+	NewTestedSum        **int64    `json:"new_tested_sum,omitempty"`
 }
 
 type FilterRequest struct {
-	LocationKey string `json:"location_key"` // Optional: key for filtering by location
-	StartDate   string `json:"start_date"`   // Optional: start date for filtering
-	EndDate     string `json:"end_date"`     // Optional: end date for filtering
+	LocationKey               string   `json:"location_key"`                            // Optional: key for filtering by location
+	LocationKeys              []string `json:"location_keys,omitempty"`                 // Optional: several keys for filtering by location
+	StartDate                 string   `json:"start_date"`                              // Optional: start date for filtering
+	EndDate                   string   `json:"end_date"`                                // Optional: end date for filtering
+	Fields                    []string `json:"fields,omitempty"`                        // Optional: metric columns to return (all when empty)
+	IncludeUpdatedAt          bool     `json:"include_updated_at,omitempty"`            // Optional: return when each row was last ingested, if the table records it
+	IncludePositivity         bool     `json:"include_positivity,omitempty"`            // Optional: return new_confirmed / new_tested as positivity
+	IncludeDaysSinceFirstCase bool     `json:"include_days_since_first_case,omitempty"` // Optional: return days since the location's first new_confirmed > 0
+	Dedupe                    *bool    `json:"dedupe,omitempty"`                        // Optional: collapse duplicate (location_key, date) rows; defaults to DEDUPE_READS
+	AsOf                      string   `json:"as_of,omitempty"`                         // Optional: return the data as known at the end of this date (versioned tables only)
+	TopK                      int      `json:"top_k,omitempty"`                         // Optional: return each location's top K rows by top_metric instead of its latest row
+	TopMetric                 string   `json:"top_metric,omitempty"`                    // Required with top_k: metric column to rank rows by
+	DateFormat                string   `json:"date_format,omitempty"`                   // Optional: "date", "rfc3339", "epoch_days" or "epoch_ms"
+	Format                    string   `json:"format,omitempty"`                        // Optional: "json" (default), "csv" or "columnar"
+	Monotonicity              string   `json:"monotonicity,omitempty"`                  // Optional: "off", "flag" or "exclude" rows whose cumulative values decrease; defaults to MONOTONICITY
+	MovingSumDays             int      `json:"moving_sum_days,omitempty"`               // Optional: add trailing sums of the selected new_* fields over this many days, see MOVING_SUM_WINDOWS
+	DryRun                    bool     `json:"dry_run,omitempty"`                       // Optional: return the generated query instead of running it (debug mode only)
 }
 
 var db clickhouse.Conn
 
+// exposedHeaders are the response headers this API sets that browsers only let scripts
+// read when listed in Access-Control-Expose-Headers
+var exposedHeaders = []string{
+	fiber.HeaderContentDisposition, // CSV downloads
+	fiber.HeaderRetryAfter,
+	requestIDHeader,
+	schemaVersionHeader,
+	"X-Warning",
+	truncatedHeader,
+	"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset",
+	"X-Rows-Read", "X-Bytes-Read",
+	totalCountHeader, queryTimeHeader,
+	"X-Tested-Unit",
+}
+
 func main() {
 	var err error
+	// Load settings from .env when present; real environment variables take precedence
+	_ = godotenv.Load()
+	cfg = loadConfig()
+
 	// Connect to ClickHouse database
 	db, err = connectClickhouse()
 	if err != nil {
 		log.Fatalf("failed to connect to ClickHouse: %v", err)
 	}
 
-	app := fiber.New()
+	if err := loadTableSchema(context.Background()); err != nil {
+		log.Printf("failed to read covid19 schema, optional columns disabled: %v", err)
+	}
+
+	app := fiber.New(fiber.Config{
+		// Sized for ingest; other routes enforce BodyLimit themselves
+		BodyLimit: cfg.IngestBodyLimit,
+		// Bound slow clients so they cannot hold connections open indefinitely
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+	})
 
+	app.Use(requestID)
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: "http://localhost:3000", // Update this to allow specific frontend origin
-		AllowMethods: "GET,POST,HEAD,PUT,DELETE,PATCH",
+		AllowOrigins:  "http://localhost:3000", // Update this to allow specific frontend origin
+		AllowMethods:  "GET,POST,HEAD,PUT,DELETE,PATCH",
+		ExposeHeaders: join(append(exposedHeaders, cfg.CORSExposeHeaders...), ","),
 	}))
 
-	app.Post("/api/timeseries", getTimeSeries)
+	if cfg.UsageLogging {
+		usageRecords = make(chan usageRecord, cfg.UsageBufferSize)
+		app.Use(usageLogger)
+	}
+
+	api := newRouteGroup(app, "/api", negotiateSchema, cacheHeaders, enforceQuota, trackResources, limitQueryTime, restorePagedBody, translateMetricAliases)
+	api.add(fiber.MethodGet, "/routes", "Lists the available routes", getRoutes)
+	api.add(fiber.MethodGet, "/location-keys", "Describes the location_key format and names the top-level locations", getLocationKeys)
+	api.add(fiber.MethodPost, "/timeseries", "Latest row per location (or each location's top-K rows) with optional filters, fields and output formats",
+		limitBody(cfg.BodyLimit), getTimeSeries)
+	api.add(fiber.MethodPost, "/excess", "Daily values of a metric compared with a baseline window's average",
+		limitBody(cfg.BodyLimit), getExcess)
+	api.add(fiber.MethodPost, "/aggregate", "Per-location totals of a daily metric with their share of the grand total",
+		limitBody(cfg.BodyLimit), getAggregate)
+	api.add(fiber.MethodPost, "/aggregate/series", "Metrics summed across locations per date, globally or under a key prefix",
+		limitBody(cfg.BodyLimit), getAggregateSeries)
+	api.add(fiber.MethodPost, "/forecast", "Naive log-linear forecast of a location's new_confirmed",
+		limitBody(cfg.BodyLimit), getForecast)
+	api.add(fiber.MethodPost, "/revisions", "Rows revised between two as-of snapshots and by how much",
+		limitBody(cfg.BodyLimit), getRevisions)
+	api.add(fiber.MethodPost, "/weekly-trend", "Week-over-week percentage change of new_confirmed per location",
+		limitBody(cfg.BodyLimit), getWeeklyTrend)
+	api.add(fiber.MethodPost, "/correlation", "Pairwise correlation matrix of a metric across locations",
+		limitBody(cfg.BodyLimit), getCorrelation)
+	api.add(fiber.MethodPost, "/groups", "Daily sums of metrics over caller-defined location groups",
+		limitBody(cfg.BodyLimit), getGroups)
+	api.add(fiber.MethodPost, "/continents", "Country series summed per continent and day",
+		limitBody(cfg.BodyLimit), getContinents)
+	api.add(fiber.MethodPost, "/rank", "A location's rank among all locations for a metric on a date",
+		limitBody(cfg.BodyLimit), getRank)
+	api.add(fiber.MethodPost, "/movers", "Locations whose rank for a metric rose or fell the most between two dates",
+		limitBody(cfg.BodyLimit), getMovers)
+	api.add(fiber.MethodPost, "/adjusted", "Daily series corrected for day-of-week and holiday reporting effects",
+		limitBody(cfg.BodyLimit), getAdjusted)
+	api.add(fiber.MethodPost, "/milestones", "First date a location's cumulative metric reached each threshold",
+		limitBody(cfg.BodyLimit), getMilestones)
+	api.add(fiber.MethodPost, "/sparklines", "Latest cumulative totals and a downsampled recent trend per location",
+		limitBody(cfg.BodyLimit), getSparklines)
+	api.add(fiber.MethodPost, "/testing-coverage", "Latest cumulative_tested per person for each location",
+		limitBody(cfg.BodyLimit), getTestingCoverage)
+	api.add(fiber.MethodPost, "/reporting-lag", "Percentiles of the delay between a row's date and its first ingestion",
+		limitBody(cfg.BodyLimit), getReportingLag)
+	api.add(fiber.MethodPost, "/growth-factor", "Daily new_confirmed relative to the average of the preceding days",
+		limitBody(cfg.BodyLimit), getGrowthFactor)
+	api.add(fiber.MethodGet, "/integrity-check", "Runs the table consistency checks and returns sample violations (admin)",
+		requireAdmin, getIntegrityCheck)
+	api.add(fiber.MethodGet, "/stale-locations", "Locations whose expected report is overdue", getStaleLocations)
+	api.add(fiber.MethodGet, "/sla", "Share of locations meeting the reporting cadence", getSLA)
+
+	admin := newRouteGroup(app, "/api/admin", requireAdmin)
+	admin.add(fiber.MethodPost, "/ingest", "Ingests newline-delimited JSON rows", ingestNDJSON)
+	admin.add(fiber.MethodPatch, "/rows", "Corrects metrics of an existing row", limitBody(cfg.BodyLimit), patchRow)
+	admin.add(fiber.MethodPost, "/consistency-check", "Starts a consistency check run", triggerConsistencyCheck)
+	admin.add(fiber.MethodGet, "/consistency", "Latest consistency check report", getConsistencyReport)
+	admin.add(fiber.MethodGet, "/usage", "API usage summary", getUsage)
+	admin.add(fiber.MethodGet, "/quotas", "Per-API-key quota usage since startup", getQuotas)
+
+	root := newRouteGroup(app, "")
+	root.add(fiber.MethodGet, "/metrics", "Prometheus metrics", adaptor.HTTPHandler(promhttp.Handler()))
+
+	// Background jobs stop when the process is asked to terminate
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	shutdown = ctx
 
-	log.Fatal(app.Listen(":8080"))
+	pingClickhouse(ctx)
+	startPingLoop(ctx)
+	startConsistencyJob(ctx)
+	if cfg.UsageLogging {
+		startUsageFlusher(ctx)
+	}
+
+	go func() {
+		<-ctx.Done()
+		if err := app.Shutdown(); err != nil {
+			log.Printf("failed to shut down server: %v", err)
+		}
+	}()
+
+	if err := app.Listen(":8080"); err != nil {
+		log.Fatal(err)
+	}
+
+	background.Wait()
+	if err := db.Close(); err != nil {
+		log.Printf("failed to close ClickHouse connection: %v", err)
+	}
 }
 
-// connectClickhouse establishes a connection to the ClickHouse database
+// connectClickhouse establishes a connection to the ClickHouse database: one pool for a
+// single CLICKHOUSE_ADDRS entry, or a replicaPool with one pool per replica
 func connectClickhouse() (clickhouse.Conn, error) {
-	return clickhouse.Open(&clickhouse.Options{
-		Addr: []string{"localhost:9000"}, // Use the appropriate ClickHouse address
-		Auth: clickhouse.Auth{
-			Database: "default",
-			Username: "default",
-			Password: "",
-		},
-		DialTimeout: 5 * time.Second,
-	})
+	pool := &replicaPool{addrs: cfg.ClickhouseAddrs}
+	for _, addr := range cfg.ClickhouseAddrs {
+		conn, err := clickhouse.Open(&clickhouse.Options{
+			Addr: []string{addr},
+			Auth: clickhouse.Auth{
+				Database: "default",
+				Username: "default",
+				Password: "",
+			},
+			DialTimeout: 5 * time.Second,
+		})
+		if err != nil {
+			pool.Close()
+			return nil, err
+		}
+		pool.replicas = append(pool.replicas, conn)
+	}
+	if len(pool.replicas) == 1 {
+		return pool.replicas[0], nil
+	}
+	return pool, nil
 }
 
 func getTimeSeries(c *fiber.Ctx) error {
@@ -72,87 +230,92 @@ func getTimeSeries(c *fiber.Ctx) error {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid filter parameters"})
 	}
 
-	// Start building the query
-	query := `
-	WITH latest_deaths_data AS (
-		SELECT location_key,
-			   date,
-			   new_deceased,
-			   new_confirmed,
-			   new_recovered,
-			   new_tested,
-			   cumulative_confirmed,
-			   cumulative_deceased,
-			   cumulative_recovered,
-			   cumulative_tested,
-			   ROW_NUMBER() OVER (PARTITION BY location_key ORDER BY date DESC) AS rn
-		FROM covid19
-	)
-	SELECT location_key,
-		   date,
-		   new_deceased,
-		   new_confirmed,
-		   new_recovered,
-		   new_tested,
-		   cumulative_confirmed,
-		   cumulative_deceased,
-		   cumulative_recovered,
-		   cumulative_tested
-	FROM latest_deaths_data
-	WHERE rn = 1
-	`
-
-	var args []interface{}
-	conditions := []string{}
-
-	// Adding filters for date range and location_key if provided
-	if filter.StartDate != "" && filter.EndDate != "" {
-		conditions = append(conditions, "date BETWEEN ? AND ?")
-		args = append(args, filter.StartDate, filter.EndDate)
-	}
-
-	if filter.LocationKey != "" {
-		conditions = append(conditions, "location_key = ?")
-		args = append(args, filter.LocationKey)
-	}
-
-	// Join the conditions with " AND " and add to the query if there are any
-	if len(conditions) > 0 {
-		query += " AND " + joinConditions(conditions, " AND ")
+	q, err := newTimeSeriesQuery(filter)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	format, err := resolveDateFormat(c, filter.DateFormat)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := validateOutput(filter.Format); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	reads, readArgs, err := filter.readConditions(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	q.filterSource(reads, readArgs)
+	query, args := q.build()
+
+	if filter.DryRun {
+		if !cfg.Debug {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "dry_run is only available in debug mode"})
+		}
+		// The reproduced request should run the query for real
+		filter.DryRun = false
+		resp, err := dryRunResponse(c, query, args, filter)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to build dry run: " + err.Error()})
+		}
+		return sendJSON(c, resp)
+	}
+
+	if q.dedupe && cfg.Debug {
+		duplicates, err := countDuplicates(c.UserContext(), q.prewhere, q.prewhereArgs)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Query execution failed: " + err.Error()})
+		}
+		addMeta(c, "collapsed_duplicates", duplicates)
+	}
+
+	keys, _ := filter.locationKeys()
+	recordUsageFilter(c, keys, filter.StartDate, filter.EndDate)
+	clampDateRange(c, filter.StartDate, filter.EndDate)
+
+	if filter.IncludePositivity || containsString(filter.Fields, "positivity") {
+		labelTesting(c)
+	}
+
+	if filter.Format == outputCSV {
+		return streamCSV(c, query, args, q.selectColumns(), outputColumns(filter.Fields, q.selectColumns()), format)
 	}
 
 	// Execute the query
-	rows, err := db.Query(context.Background(), query, args...)
+	rows, err := db.Query(c.UserContext(), query+rowLimitClause(c), args...)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Query execution failed: " + err.Error()})
 	}
 	defer rows.Close()
 
+	columns := q.selectColumns()
 	var data []TimeSeriesData
+	decreasing := 0
 	for rows.Next() {
-		var ts TimeSeriesData
-		if err := rows.Scan(
-			&ts.LocationKey,
-			&ts.Date,
-			&ts.NewConfirmed,
-			&ts.NewDeceased,
-			&ts.NewRecovered,
-			&ts.NewTested,
-			&ts.CumulativeConfirmed,
-			&ts.CumulativeDeceased,
-			&ts.CumulativeRecovered,
-			&ts.CumulativeTested,
-		); err != nil {
+		ts := TimeSeriesData{Date: Date{format: format}}
+		if err := rows.Scan(ts.scanDest(columns)...); err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Row scan failed: " + err.Error()})
 		}
+		roundPtr(ts.Positivity)
+		if len(ts.DecreasingColumns) > 0 {
+			decreasing++
+		}
 		data = append(data, ts)
 	}
 
 	if err := rows.Err(); err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading rows"})
 	}
+	keep, ok := applyRowLimit(c, len(data))
+	if !ok {
+		return c.Status(http.StatusBadRequest).JSON(rowLimitError(c))
+	}
+	data = data[:keep]
+	if decreasing > 0 {
+		addWarning(c, fmt.Sprintf("%d rows have cumulative values lower than the previous day, see decreasing_columns", decreasing))
+	}
 
-	return c.JSON(data)
+	return respondTimeSeries(c, filter, data, columns)
 }
 
 // joinConditions joins the slice of conditions with the specified separator
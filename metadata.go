@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Handling of location_key values repeated in METADATA_TABLE or POPULATION_TABLE, see
+// METADATA_DUPLICATES. Joins collapse them either way; warn also tells the client.
+const (
+	metadataDuplicatesCollapse = "collapse" // use one row per key silently
+	metadataDuplicatesWarn     = "warn"     // use one row per key and add a warning
+)
+
+// normalizeMetadataDuplicates validates METADATA_DUPLICATES, defaulting to collapse
+func normalizeMetadataDuplicates(behavior string) string {
+	if behavior == metadataDuplicatesWarn {
+		return behavior
+	}
+	return metadataDuplicatesCollapse
+}
+
+// keyedSource returns a subquery of table with exactly one row per location_key, so joining
+// it cannot multiply rows when the table repeats a key. Each column is an aggregate
+// expression choosing the value kept, e.g. "max(population) AS population".
+func keyedSource(table string, columns ...string) string {
+	return "(SELECT location_key, " + join(columns, ", ") + " FROM " + quoteIdentifier(table) + " GROUP BY location_key)"
+}
+
+// duplicateKeysCheckInterval bounds how often a table is counted for repeated keys
+const duplicateKeysCheckInterval = time.Minute
+
+// duplicateKeys caches the last count of repeated location_key rows per table
+var duplicateKeys struct {
+	sync.Mutex
+	checked    map[string]time.Time
+	duplicates map[string]uint64
+}
+
+// warnDuplicateKeys adds a warning when METADATA_DUPLICATES=warn and table has rows
+// repeating a location_key. A failed count is ignored, as the join is safe regardless.
+func warnDuplicateKeys(c *fiber.Ctx, table string) {
+	if cfg.MetadataDuplicates != metadataDuplicatesWarn {
+		return
+	}
+	duplicateKeys.Lock()
+	defer duplicateKeys.Unlock()
+	if duplicateKeys.checked == nil {
+		duplicateKeys.checked, duplicateKeys.duplicates = map[string]time.Time{}, map[string]uint64{}
+	}
+	if time.Since(duplicateKeys.checked[table]) >= duplicateKeysCheckInterval {
+		var duplicates uint64
+		query := "SELECT count() - uniqExact(location_key) FROM " + quoteIdentifier(table)
+		if err := db.QueryRow(c.UserContext(), query).Scan(&duplicates); err != nil {
+			return
+		}
+		duplicateKeys.checked[table], duplicateKeys.duplicates[table] = time.Now(), duplicates
+	}
+	if duplicates := duplicateKeys.duplicates[table]; duplicates > 0 {
+		addWarning(c, fmt.Sprintf("%s has %d rows repeating a location_key; one row per key was used", table, duplicates))
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestKeyedSource(t *testing.T) {
+	got := keyedSource("demographics", "max(`population`) AS population", "any(`name`) AS name")
+	want := "(SELECT location_key, max(`population`) AS population, any(`name`) AS name FROM `demographics` GROUP BY location_key)"
+	if got != want {
+		t.Errorf("keyedSource = %s, want %s", got, want)
+	}
+}
+
+// duplicateWarning runs warnDuplicateKeys for table and returns the X-Warning sent
+func duplicateWarning(t *testing.T, table string) string {
+	t.Helper()
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		warnDuplicateKeys(c, table)
+		return nil
+	})
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.Header.Get("X-Warning")
+}
+
+func TestWarnDuplicateKeys(t *testing.T) {
+	defer func(old string) { cfg.MetadataDuplicates = old }(cfg.MetadataDuplicates)
+	tests := []struct {
+		name     string
+		behavior string
+		row      stubRow
+		warning  string
+		queries  int
+	}{
+		{"duplicates", metadataDuplicatesWarn, stubRow{values: []any{uint64(2)}},
+			"demographics has 2 rows repeating a location_key; one row per key was used", 1},
+		{"unique keys", metadataDuplicatesWarn, stubRow{values: []any{uint64(0)}}, "", 1},
+		{"failed count", metadataDuplicatesWarn, stubRow{err: errors.New("table is missing")}, "", 2},
+		{"collapse", metadataDuplicatesCollapse, stubRow{values: []any{uint64(2)}}, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.MetadataDuplicates = tt.behavior
+			duplicateKeys.Lock()
+			duplicateKeys.checked, duplicateKeys.duplicates = nil, nil
+			duplicateKeys.Unlock()
+			stub := useStubConn(t, func(query string, args ...any) driver.Row { return tt.row })
+
+			// A second request within the interval reuses the count, unless it failed
+			for i := 0; i < 2; i++ {
+				if got := duplicateWarning(t, "demographics"); got != tt.warning {
+					t.Errorf("request %d: X-Warning = %q, want %q", i+1, got, tt.warning)
+				}
+			}
+			if len(stub.queries) != tt.queries {
+				t.Errorf("%d counts of repeated keys, want %d", len(stub.queries), tt.queries)
+			}
+			for _, query := range stub.queries {
+				if !strings.Contains(query, "uniqExact(location_key) FROM `demographics`") {
+					t.Errorf("count query = %s, want repeated keys of demographics", query)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// consistencyViolations reports the violation count of the latest run of each consistency check
+var consistencyViolations = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "covid19_consistency_violations",
+	Help: "Violations found by the latest run of each table consistency check.",
+}, []string{"check"})
+
+// clickhouseUp is 1 when the last keep-alive ping succeeded and 0 otherwise
+var clickhouseUp = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "covid19_clickhouse_up",
+	Help: "Whether the last ClickHouse keep-alive ping succeeded.",
+})
+
+// usageRecordsDropped counts usage records discarded because the buffer was full
+var usageRecordsDropped = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "covid19_usage_records_dropped_total",
+	Help: "Usage records dropped because the in-memory buffer was full.",
+})
+
+// rowsReadTotal and bytesReadTotal account ClickHouse reads per consumer (hashed API key
+// listed in API_KEY_QUOTAS, or anon for everyone else)
+var (
+	rowsReadTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "covid19_rows_read_total",
+		Help: "Rows read by ClickHouse on behalf of each consumer.",
+	}, []string{"consumer"})
+	bytesReadTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "covid19_bytes_read_total",
+		Help: "Bytes read by ClickHouse on behalf of each consumer.",
+	}, []string{"consumer"})
+)
+
+// replicaRetries counts reads retried on another replica after the given one was unreachable
+var replicaRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "covid19_replica_retries_total",
+	Help: "Reads retried on another ClickHouse replica because this one could not be reached.",
+}, []string{"replica"})
@@ -0,0 +1,13 @@
+-- Skip indexes for the location_key and date predicates emitted by the query builder.
+--
+-- Check the current sorting key first:
+--   SELECT sorting_key FROM system.tables WHERE database = currentDatabase() AND name = 'covid19';
+-- If it already starts with (location_key, date) these indexes add nothing and can be skipped.
+-- ClickHouse cannot reorder an existing ORDER BY, so a table sorted differently either gets
+-- these indexes or is rebuilt with ORDER BY (location_key, date) via INSERT ... SELECT.
+
+ALTER TABLE covid19 ADD INDEX IF NOT EXISTS idx_location_key location_key TYPE set(0) GRANULARITY 4;
+ALTER TABLE covid19 ADD INDEX IF NOT EXISTS idx_date date TYPE minmax GRANULARITY 1;
+
+ALTER TABLE covid19 MATERIALIZE INDEX idx_location_key;
+ALTER TABLE covid19 MATERIALIZE INDEX idx_date;
@@ -0,0 +1,13 @@
+-- One row per consistency check per run, written by the consistency job.
+
+CREATE TABLE IF NOT EXISTS consistency_reports
+(
+    checked_at  DateTime,
+    check       LowCardinality(String),
+    violations  UInt64,
+    duration_ms UInt64,
+    error       String
+)
+ENGINE = MergeTree
+ORDER BY (checked_at, check)
+TTL checked_at + INTERVAL 90 DAY;
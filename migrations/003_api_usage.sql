@@ -0,0 +1,23 @@
+-- One row per API request, written by the usage logger when USAGE_LOGGING is on.
+-- ip and body stay empty unless USAGE_STORE_IPS / USAGE_STORE_BODIES are enabled.
+
+CREATE TABLE IF NOT EXISTS api_usage
+(
+    timestamp     DateTime,
+    route         LowCardinality(String),
+    method        LowCardinality(String),
+    location_keys Array(String),
+    start_date    String,
+    end_date      String,
+    consumer      String,
+    status        UInt16,
+    duration_ms   UInt32,
+    rows          UInt32,
+    cache_hit     Bool,
+    ip            String,
+    body          String
+)
+ENGINE = MergeTree
+PARTITION BY toYYYYMM(timestamp)
+ORDER BY (timestamp, route)
+TTL timestamp + INTERVAL 180 DAY;
@@ -0,0 +1,3 @@
+-- Request ID of each usage row, for correlating it with client and proxy logs.
+
+ALTER TABLE api_usage ADD COLUMN IF NOT EXISTS request_id String;
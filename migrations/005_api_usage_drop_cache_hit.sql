@@ -0,0 +1,3 @@
+-- The server keeps no response cache, so cache_hit was always false.
+
+ALTER TABLE api_usage DROP COLUMN IF EXISTS cache_hit;
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxMilestoneThresholds caps the thresholds one /api/milestones request may ask for
+const maxMilestoneThresholds = 100
+
+// MilestoneRequest asks when a location's cumulative metric first reached each threshold
+type MilestoneRequest struct {
+	LocationKey string  `json:"location_key"` // Required
+	Metric      string  `json:"metric"`       // Optional: a cumulative_* column, default cumulative_confirmed
+	Threshold   int64   `json:"threshold"`    // One of threshold or thresholds is required
+	Thresholds  []int64 `json:"thresholds"`
+	AsOf        string  `json:"as_of,omitempty"`
+	Dedupe      *bool   `json:"dedupe,omitempty"`
+	DateFormat  string  `json:"date_format,omitempty"`
+}
+
+// Milestone is the first date a threshold was met, null if it never was
+type Milestone struct {
+	Threshold int64 `json:"threshold"`
+	Date      *Date `json:"date"`
+}
+
+// MilestoneData lists a location's milestones in ascending threshold order
+type MilestoneData struct {
+	LocationKey string      `json:"location_key"`
+	Metric      string      `json:"metric"`
+	Milestones  []Milestone `json:"milestones"`
+}
+
+// thresholds merges threshold and thresholds, sorted ascending without duplicates
+func (r MilestoneRequest) thresholds() []int64 {
+	all := append([]int64{}, r.Thresholds...)
+	if r.Threshold != 0 {
+		all = append(all, r.Threshold)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+	unique := all[:0]
+	for i, t := range all {
+		if i == 0 || t != all[i-1] {
+			unique = append(unique, t)
+		}
+	}
+	return unique
+}
+
+// validate checks the location, metric and thresholds
+func (r MilestoneRequest) validate() error {
+	if r.LocationKey == "" {
+		return errors.New("location_key is required")
+	}
+	// A threshold on a daily metric is not a milestone: it can be met, missed and met again
+	if !isMetricColumn(r.Metric) || !strings.HasPrefix(r.Metric, "cumulative_") {
+		return fmt.Errorf("metric must be one of the cumulative_* columns, got %q", r.Metric)
+	}
+	thresholds := r.thresholds()
+	if len(thresholds) == 0 {
+		return errors.New("threshold or thresholds is required")
+	}
+	if len(thresholds) > maxMilestoneThresholds {
+		return fmt.Errorf("at most %d thresholds are allowed", maxMilestoneThresholds)
+	}
+	for _, t := range thresholds {
+		if t <= 0 {
+			return fmt.Errorf("thresholds must be positive, got %d", t)
+		}
+	}
+	return nil
+}
+
+// getMilestones handles POST /api/milestones. Each threshold's date is the earliest day
+// whose cumulative value is at least the threshold, so a later downward correction does
+// not move a milestone already reached.
+func getMilestones(c *fiber.Ctx) error {
+	req := MilestoneRequest{Metric: "cumulative_confirmed"}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid filter parameters"})
+	}
+	if err := req.validate(); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	filter := FilterRequest{LocationKey: req.LocationKey, AsOf: req.AsOf, Dedupe: req.Dedupe}
+	format, err := resolveDateFormat(c, req.DateFormat)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	reads, readArgs, err := filter.readConditions(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	recordUsageFilter(c, []interface{}{req.LocationKey}, "", "")
+
+	thresholds := req.thresholds()
+	selects := []string{"count()"}
+	args := []interface{}{}
+	for _, t := range thresholds {
+		selects = append(selects, "minIfOrNull(date, "+req.Metric+" >= ?)")
+		args = append(args, t)
+	}
+	conditions := append([]string{"location_key = ?"}, reads...)
+	args = append(append(args, req.LocationKey), readArgs...)
+	query := `
+	SELECT ` + join(selects, ", ") + `
+	FROM ` + readSource(conditions, filter.dedupe())
+
+	var days uint64
+	dates := make([]*time.Time, len(thresholds))
+	dest := []interface{}{&days}
+	for i := range dates {
+		dest = append(dest, &dates[i])
+	}
+	if err := db.QueryRow(c.UserContext(), query, args...).Scan(dest...); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Query execution failed: " + err.Error()})
+	}
+	if days == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "No rows for " + req.LocationKey})
+	}
+
+	result := MilestoneData{LocationKey: req.LocationKey, Metric: req.Metric, Milestones: []Milestone{}}
+	for i, t := range thresholds {
+		milestone := Milestone{Threshold: t}
+		if dates[i] != nil {
+			milestone.Date = &Date{Time: *dates[i], format: format}
+		}
+		result.Milestones = append(result.Milestones, milestone)
+	}
+
+	return respond(c, result)
+}
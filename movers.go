@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// MoversRequest asks which locations changed rank the most for a metric between two dates
+type MoversRequest struct {
+	FilterRequest
+	Metric   string `json:"metric"`    // Required: metric column to rank by
+	FromDate string `json:"from_date"` // Required
+	ToDate   string `json:"to_date"`   // Required
+	Limit    int    `json:"limit"`     // Optional: climbers and fallers returned each, default 10
+}
+
+// RankChange is a location's rank on both dates; Change is positive for a climb
+type RankChange struct {
+	LocationKey string `json:"location_key"`
+	FromRank    uint64 `json:"from_rank"`
+	ToRank      uint64 `json:"to_rank"`
+	Change      int64  `json:"change"`
+	FromValue   int32  `json:"from_value"`
+	ToValue     int32  `json:"to_value"`
+}
+
+// MoversData lists the biggest climbers and fallers between the dates
+type MoversData struct {
+	Metric   string       `json:"metric"`
+	FromDate Date         `json:"from_date"`
+	ToDate   Date         `json:"to_date"`
+	Ranked   [2]uint64    `json:"ranked"`    // locations ranked on from_date and on to_date
+	Climbers []RankChange `json:"climbers"`  // largest positive change first
+	Fallers  []RankChange `json:"fallers"`   // largest negative change first
+	OnlyFrom uint64       `json:"only_from"` // locations with a row on from_date only
+	OnlyTo   uint64       `json:"only_to"`   // locations with a row on to_date only
+}
+
+// validate checks the metric, dates and limit
+func (r MoversRequest) validate() error {
+	if !isMetricColumn(r.Metric) {
+		return fmt.Errorf("unknown metric %q", r.Metric)
+	}
+	if _, _, err := parseDateRange("from_date", r.FromDate, "to_date", r.ToDate); err != nil {
+		return err
+	}
+	if r.FromDate == r.ToDate {
+		return fmt.Errorf("from_date and to_date must differ")
+	}
+	if r.Limit < 1 || r.Limit > 100 {
+		return fmt.Errorf("limit must be between 1 and 100")
+	}
+	return nil
+}
+
+// getMovers handles POST /api/movers. Locations are ranked on each date separately, highest
+// value first, with the competition ranking of /api/rank (ties share the best rank), and
+// only locations with a row on both dates can climb or fall; the others are counted in
+// only_from and only_to. Equal changes are ordered by location_key.
+func getMovers(c *fiber.Ctx) error {
+	req := MoversRequest{Limit: 10}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid filter parameters"})
+	}
+	if err := req.validate(); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	keys, err := req.locationKeys()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	format, err := resolveDateFormat(c, req.DateFormat)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	reads, readArgs, err := req.readConditions(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	from, to, _ := parseDateRange("from_date", req.FromDate, "to_date", req.ToDate)
+	fromDay, toDay := from.Format(time.DateOnly), to.Format(time.DateOnly)
+	recordUsageFilter(c, keys, fromDay, toDay)
+
+	args := []interface{}{fromDay, toDay, fromDay, toDay}
+	conditions := []string{"date IN (?, ?)"}
+	if len(keys) > 0 {
+		condition, arg := locationCondition(keys)
+		conditions = append(conditions, condition)
+		args = append(args, arg)
+	}
+	conditions = append(conditions, reads...)
+	args = append(args, readArgs...)
+	query := `
+	WITH toDate(?) AS from_date, toDate(?) AS to_date
+	SELECT location_key,
+		   countIf(date = from_date), countIf(date = to_date),
+		   maxIf(rank, date = from_date), maxIf(rank, date = to_date),
+		   maxIf(value, date = from_date), maxIf(value, date = to_date)
+	FROM (
+		SELECT location_key, date, value, rank() OVER (PARTITION BY date ORDER BY value DESC) AS rank
+		FROM (
+			SELECT location_key, date, ` + req.Metric + ` AS value
+			FROM ` + readSource(conditions, req.dedupe()) + `
+		)
+	)
+	GROUP BY location_key`
+
+	rows, err := db.Query(c.UserContext(), query, args...)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Query execution failed: " + err.Error()})
+	}
+	defer rows.Close()
+
+	result := MoversData{Metric: req.Metric, FromDate: Date{Time: from, format: format}, ToDate: Date{Time: to, format: format}}
+	var both []RankChange
+	for rows.Next() {
+		var r RankChange
+		var onFrom, onTo uint64
+		if err := rows.Scan(&r.LocationKey, &onFrom, &onTo, &r.FromRank, &r.ToRank, &r.FromValue, &r.ToValue); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Row scan failed: " + err.Error()})
+		}
+		switch {
+		case onFrom > 0 && onTo > 0:
+			r.Change = int64(r.FromRank) - int64(r.ToRank)
+			both = append(both, r)
+			result.Ranked[0]++
+			result.Ranked[1]++
+		case onFrom > 0:
+			result.OnlyFrom++
+			result.Ranked[0]++
+		default:
+			result.OnlyTo++
+			result.Ranked[1]++
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading rows"})
+	}
+
+	result.Climbers, result.Fallers = []RankChange{}, []RankChange{}
+	for _, r := range both {
+		if r.Change > 0 {
+			result.Climbers = append(result.Climbers, r)
+		} else if r.Change < 0 {
+			result.Fallers = append(result.Fallers, r)
+		}
+	}
+	sortMovers(result.Climbers, func(r RankChange) int64 { return r.Change })
+	sortMovers(result.Fallers, func(r RankChange) int64 { return -r.Change })
+	result.Climbers = result.Climbers[:min(len(result.Climbers), req.Limit)]
+	result.Fallers = result.Fallers[:min(len(result.Fallers), req.Limit)]
+
+	return respond(c, result)
+}
+
+// sortMovers orders changes by size descending, then by location_key
+func sortMovers(changes []RankChange, size func(RankChange) int64) {
+	sort.Slice(changes, func(i, j int) bool {
+		if size(changes[i]) != size(changes[j]) {
+			return size(changes[i]) > size(changes[j])
+		}
+		return changes[i].LocationKey < changes[j].LocationKey
+	})
+}
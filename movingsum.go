@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// movingSumWindows parses MOVING_SUM_WINDOWS, the trailing window lengths in days a request
+// may ask for, skipping invalid entries
+func movingSumWindows(entries []string) []int {
+	var windows []int
+	for _, entry := range entries {
+		days, err := strconv.Atoi(strings.TrimSpace(entry))
+		if err != nil || days < 2 || days > 365 {
+			log.Printf("ignoring invalid MOVING_SUM_WINDOWS entry %q", entry)
+			continue
+		}
+		windows = append(windows, days)
+	}
+	return windows
+}
+
+// validateMovingSumDays checks a requested window against MOVING_SUM_WINDOWS
+func validateMovingSumDays(days int) error {
+	for _, allowed := range cfg.MovingSumWindows {
+		if days == allowed {
+			return nil
+		}
+	}
+	allowed := make([]string, len(cfg.MovingSumWindows))
+	for i, d := range cfg.MovingSumWindows {
+		allowed[i] = strconv.Itoa(d)
+	}
+	return fmt.Errorf("moving_sum_days must be one of %s, got %d", join(allowed, ", "), days)
+}
+
+// movingSumColumn names the trailing sum of a new_* column
+func movingSumColumn(column string) string {
+	return column + "_sum"
+}
+
+// movingSumsCTE sums each column over the location's last days reported rows, ending
+// with the current one. Rows with fewer than days rows behind them get NULL rather than
+// a partial sum.
+func movingSumsCTE(source string, columns []string, days int) string {
+	sums := make([]string, len(columns))
+	for i, column := range columns {
+		sums[i] = "if(row_number() OVER w >= " + strconv.Itoa(days) + ", sum(" + column + ") OVER w, NULL) AS " + movingSumColumn(column)
+	}
+	return `
+	moving_sums AS (
+		SELECT location_key, date,
+			   ` + join(sums, ",\n\t\t\t   ") + `
+		FROM ` + source + `
+		WINDOW w AS (PARTITION BY location_key ORDER BY date ROWS BETWEEN ` + strconv.Itoa(days-1) + ` PRECEDING AND CURRENT ROW)
+	)`
+}
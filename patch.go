@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/gofiber/fiber/v2"
+)
+
+// PatchRequest corrects some metrics of one existing (location_key, date) row
+type PatchRequest struct {
+	LocationKey string           `json:"location_key"` // Required
+	Date        string           `json:"date"`         // Required: YYYY-MM-DD or RFC3339
+	Fields      map[string]int32 `json:"fields"`       // Required: metric column → corrected value
+}
+
+// validate checks the row key and that only metric columns are updated
+func (r PatchRequest) validate() (time.Time, error) {
+	if r.LocationKey == "" {
+		return time.Time{}, errors.New("location_key is required")
+	}
+	date, err := parseDate(r.Date)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("date: %w", err)
+	}
+	if len(r.Fields) == 0 {
+		return time.Time{}, errors.New("fields must name at least one metric")
+	}
+	for field := range r.Fields {
+		if !isMetricColumn(field) {
+			return time.Time{}, fmt.Errorf("unknown field %q", field)
+		}
+	}
+	return date, nil
+}
+
+// patchRow handles PATCH /api/admin/rows with an ALTER TABLE ... UPDATE mutation. On a
+// versioned table only the latest revision is corrected, so as_of reads of earlier
+// snapshots are unaffected. Mutations run asynchronously: the response is 202 and the
+// change becomes visible once ClickHouse applies it, unless ?wait=true asks to block
+// until it has (200).
+func patchRow(c *fiber.Ctx) error {
+	var req PatchRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid patch body"})
+	}
+	date, err := req.validate()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	day := date.Format(time.DateOnly)
+
+	conditions := []string{"location_key = ?", "date = ?"}
+	args := []interface{}{req.LocationKey, day}
+
+	var rows uint64
+	latest := "toDateTime(0)"
+	if tableHasColumn(cfg.UpdatedAtColumn) {
+		latest = "max(" + quoteIdentifier(cfg.UpdatedAtColumn) + ")"
+	}
+	var revision time.Time
+	query := "SELECT count(), " + latest + " FROM covid19 WHERE " + join(conditions, " AND ")
+	if err := db.QueryRow(c.UserContext(), query, args...).Scan(&rows, &revision); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Query execution failed: " + err.Error()})
+	}
+	if rows == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "No row for " + req.LocationKey + " on " + day})
+	}
+	if tableHasColumn(cfg.UpdatedAtColumn) {
+		conditions = append(conditions, quoteIdentifier(cfg.UpdatedAtColumn)+" = ?")
+		args = append(args, revision)
+	}
+
+	fields := make([]string, 0, len(req.Fields))
+	for field := range req.Fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	assignments := make([]string, len(fields))
+	values := make([]interface{}, len(fields))
+	for i, field := range fields {
+		assignments[i] = field + " = ?"
+		values[i] = req.Fields[field]
+	}
+
+	// Mutations never run under a read timeout, and do not stop when the client leaves
+	ctx := context.WithoutCancel(c.UserContext())
+	wait := c.QueryBool("wait", false)
+	if wait {
+		ctx = clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{"mutations_sync": 1}))
+	}
+	statement := "ALTER TABLE covid19 UPDATE " + join(assignments, ", ") + " WHERE " + join(conditions, " AND ")
+	if err := db.Exec(ctx, statement, append(values, args...)...); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Mutation failed: " + err.Error()})
+	}
+
+	status, state := http.StatusAccepted, "queued"
+	if wait {
+		status, state = http.StatusOK, "applied"
+	}
+	c.Status(status)
+	return sendJSON(c, fiber.Map{"location_key": req.LocationKey, "date": day, "updated": fields, "status": state})
+}
@@ -0,0 +1,36 @@
+package main
+
+// Handling of locations without a usable population in per-capita results, see
+// PER_CAPITA_ZERO_POPULATION
+const (
+	perCapitaNull    = "null"    // keep the location with a null per-capita value
+	perCapitaExclude = "exclude" // leave the location out
+)
+
+// normalizePerCapitaZero validates PER_CAPITA_ZERO_POPULATION, defaulting to null
+func normalizePerCapitaZero(behavior string) string {
+	if behavior == perCapitaExclude {
+		return behavior
+	}
+	return perCapitaNull
+}
+
+// populationSource is a subquery with one population per location from POPULATION_TABLE;
+// when a key is repeated, the largest population is used
+func populationSource() string {
+	return keyedSource(cfg.PopulationTable, "max("+quoteIdentifier(cfg.PopulationColumn)+") AS population")
+}
+
+// withPopulation restricts conditions to locations with a positive population
+const withPopulation = "location_key IN (SELECT location_key FROM %s WHERE population > 0)"
+
+// per100k scales value to a rate per 100,000 people. A zero population (which is also
+// what locations missing from POPULATION_TABLE get) yields a null rate, never an infinity.
+func per100k(value int64, population uint64) **float64 {
+	rate := new(*float64)
+	if population > 0 {
+		r := round(float64(value) / float64(population) * 100000)
+		*rate = &r
+	}
+	return rate
+}
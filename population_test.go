@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPer100k(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      int64
+		population uint64
+		want       string
+	}{
+		{"known population", 250, 1000000, `{"location_key":"XX","total":250,"percent_of_total":null,"population":1000000,"per_100k":25}`},
+		// Locations missing from POPULATION_TABLE are scanned as population 0
+		{"zero or missing population", 250, 0, `{"location_key":"XX","total":250,"percent_of_total":null,"population":0,"per_100k":null}`},
+		{"zero value", 0, 1000000, `{"location_key":"XX","total":0,"percent_of_total":null,"population":1000000,"per_100k":0}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := AggregateData{LocationKey: "XX", Total: tt.value, Population: &tt.population}
+			a.Per100k = per100k(tt.value, tt.population)
+			got, err := json.Marshal(a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("per100k(%d, %d) marshals to %s, want %s", tt.value, tt.population, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithPopulation(t *testing.T) {
+	defer func(old string) { cfg.PopulationTable = old }(cfg.PopulationTable)
+	cfg.PopulationTable = "demographics"
+	got := fmt.Sprintf(withPopulation, populationSource())
+	if !strings.Contains(got, "FROM `demographics`") || !strings.Contains(got, "population > 0") {
+		t.Errorf("exclude condition = %q, want the positive populations of demographics", got)
+	}
+}
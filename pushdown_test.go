@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// pushdownFilter selects a few locations over a range, so both the location PREWHERE and
+// the outer date range are used
+var pushdownFilter = FilterRequest{
+	LocationKeys: []string{"US", "FR", "DE"}, StartDate: "2021-01-01", EndDate: "2021-12-31",
+	Fields: []string{"new_deceased", "cumulative_tested"},
+}
+
+// buildWith renders filter's query with USE_PREWHERE set to prewhere
+func buildWith(t *testing.T, filter FilterRequest, prewhere bool) (*timeSeriesQuery, string, []interface{}) {
+	t.Helper()
+	defer func(old bool) { cfg.UsePrewhere = old }(cfg.UsePrewhere)
+	cfg.UsePrewhere = prewhere
+	q, err := newTimeSeriesQuery(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, args := q.build()
+	return q, query, args
+}
+
+// TestPrewhereEquivalence checks that PREWHERE only changes the keyword: the same
+// predicates filter the read, and the date range is still applied to the latest row
+func TestPrewhereEquivalence(t *testing.T) {
+	_, prewhere, prewhereArgs := buildWith(t, pushdownFilter, true)
+	_, where, whereArgs := buildWith(t, pushdownFilter, false)
+	if got := strings.Replace(prewhere, "PREWHERE", "WHERE", 1); got != where {
+		t.Errorf("PREWHERE query differs beyond the keyword:\n%s\n%s", prewhere, where)
+	}
+	if fmt.Sprint(prewhereArgs) != fmt.Sprint(whereArgs) {
+		t.Errorf("args = %v with PREWHERE, %v without", prewhereArgs, whereArgs)
+	}
+	// Location predicates keep whole partitions, so they may filter the read; the date
+	// range would change which row is the latest and must stay outside
+	cte, outer, _ := strings.Cut(prewhere, "FROM latest_data")
+	if !strings.Contains(cte, "PREWHERE (location_key IN ?)") || strings.Contains(cte, "date BETWEEN") {
+		t.Errorf("read filtered by more than the locations:\n%s", cte)
+	}
+	if !strings.Contains(outer, "date BETWEEN ? AND ?") {
+		t.Errorf("date range not applied to the latest row:\n%s", outer)
+	}
+}
+
+// TestColumnPruning checks that only the requested metrics are read, and that scanning
+// the pruned row gives the requested fields the values of the full row
+func TestColumnPruning(t *testing.T) {
+	pruned, query, _ := buildWith(t, pushdownFilter, true)
+	for _, column := range metricColumns {
+		requested := column == "new_deceased" || column == "cumulative_tested"
+		if strings.Contains(query, column) != requested {
+			t.Errorf("%s read = %v, want %v:\n%s", column, !requested, requested, query)
+		}
+	}
+
+	full, _, _ := buildWith(t, FilterRequest{LocationKeys: pushdownFilter.LocationKeys}, true)
+	values := map[string]any{"location_key": "US", "date": Date{}.Time}
+	for i, column := range metricColumns {
+		v := int32(i + 1)
+		values[column] = &v
+	}
+	scan := func(columns []string) TimeSeriesData {
+		var ts TimeSeriesData
+		row := stubRow{}
+		for _, column := range columns {
+			row.values = append(row.values, values[column])
+		}
+		if err := row.Scan(ts.scanDest(columns)...); err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+	got := scan(pruned.selectColumns())
+	want := scan(full.selectColumns())
+	want = TimeSeriesData{Date: want.Date, LocationKey: want.LocationKey, NewDeceased: want.NewDeceased, CumulativeTested: want.CumulativeTested}
+	gotJSON, _ := json.Marshal(got)
+	wantJSON, _ := json.Marshal(want)
+	if string(gotJSON) != string(wantJSON) {
+		t.Errorf("pruned row = %s, want %s", gotJSON, wantJSON)
+	}
+}
+
+// testClickhouse connects to the ClickHouse at CLICKHOUSE_TEST_ADDR, skipping the test or
+// benchmark when it is not set
+func testClickhouse(tb testing.TB) clickhouse.Conn {
+	tb.Helper()
+	return testClickhouseDatabase(tb, "")
+}
+
+// testClickhouseDatabase is testClickhouse with database as the current database
+func testClickhouseDatabase(tb testing.TB, database string) clickhouse.Conn {
+	tb.Helper()
+	addr := os.Getenv("CLICKHOUSE_TEST_ADDR")
+	if addr == "" {
+		tb.Skip("CLICKHOUSE_TEST_ADDR not set")
+	}
+	conn, err := clickhouse.Open(&clickhouse.Options{Addr: []string{addr}, Auth: clickhouse.Auth{Database: database}})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// TestPushdownOnClickHouse runs the read with and without PREWHERE and pruning against
+// the ClickHouse at CLICKHOUSE_TEST_ADDR, checks that they return the same rows, and logs
+// the rows and bytes each read from system.query_log. Run with -v to see the numbers.
+func TestPushdownOnClickHouse(t *testing.T) {
+	conn := testClickhouse(t)
+	ctx := context.Background()
+	run := func(name string, filter FilterRequest, prewhere bool) string {
+		q, query, args := buildWith(t, filter, prewhere)
+		id := fmt.Sprintf("pushdown-test-%s-%d", name, os.Getpid())
+		rows, err := conn.Query(clickhouse.Context(ctx, clickhouse.WithQueryID(id)), query+"\n\tORDER BY location_key", args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		var data []TimeSeriesData
+		for rows.Next() {
+			var ts TimeSeriesData
+			if err := rows.Scan(ts.scanDest(q.selectColumns())...); err != nil {
+				t.Fatal(err)
+			}
+			// Compared on the requested fields only
+			data = append(data, TimeSeriesData{Date: ts.Date, LocationKey: ts.LocationKey, NewDeceased: ts.NewDeceased, CumulativeTested: ts.CumulativeTested})
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := conn.Exec(ctx, "SYSTEM FLUSH LOGS"); err != nil {
+			t.Fatal(err)
+		}
+		var readRows, readBytes uint64
+		err = conn.QueryRow(ctx, "SELECT read_rows, read_bytes FROM system.query_log WHERE query_id = ? AND type = 'QueryFinish'", id).
+			Scan(&readRows, &readBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Logf("%s: %d rows, rows_read %d, bytes_read %d", name, len(data), readRows, readBytes)
+		out, _ := json.Marshal(data)
+		return string(out)
+	}
+
+	all := pushdownFilter
+	all.Fields = nil
+	before := run("where-all-columns", all, false)
+	if after := run("prewhere-pruned", pushdownFilter, true); after != before {
+		t.Errorf("PREWHERE and pruning changed the result:\n%s\n%s", after, before)
+	}
+}
@@ -0,0 +1,581 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/gofiber/fiber/v2"
+)
+
+// metricColumns lists the metric columns of the covid19 table in response order
+var metricColumns = []string{
+	"new_confirmed",
+	"new_deceased",
+	"new_recovered",
+	"new_tested",
+	"cumulative_confirmed",
+	"cumulative_deceased",
+	"cumulative_recovered",
+	"cumulative_tested",
+}
+
+// isMetricColumn reports whether name is one of the known metric columns
+func isMetricColumn(name string) bool {
+	for _, column := range metricColumns {
+		if column == name {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveFields validates the requested fields and returns the metric columns to select.
+// An empty request (or one naming only non-metric columns) selects DEFAULT_FIELDS.
+func resolveFields(fields []string) ([]string, error) {
+	if len(fields) == 0 {
+		return defaultFields(), nil
+	}
+	seen := map[string]bool{}
+	columns := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if containsString(keyColumns, field) || containsString(computedFields, field) {
+			// Always selected or requested separately; listed only to position them in exports
+			continue
+		}
+		if !isMetricColumn(field) {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+		if seen[field] {
+			continue
+		}
+		seen[field] = true
+		columns = append(columns, field)
+	}
+	if len(columns) == 0 {
+		return defaultFields(), nil
+	}
+	return columns, nil
+}
+
+// defaultFields returns the metric columns selected when a request names none
+func defaultFields() []string {
+	if len(cfg.DefaultFields) == 0 {
+		return metricColumns
+	}
+	return cfg.DefaultFields
+}
+
+// normalizeDefaultFields keeps the metric columns of DEFAULT_FIELDS, dropping unknown
+// names; an empty result means every metric
+func normalizeDefaultFields(fields []string) []string {
+	var columns []string
+	for _, field := range fields {
+		if !isMetricColumn(field) {
+			log.Printf("ignoring unknown DEFAULT_FIELDS entry %q", field)
+			continue
+		}
+		if !containsString(columns, field) {
+			columns = append(columns, field)
+		}
+	}
+	return columns
+}
+
+// Behaviors for requests naming both location_key and location_keys
+const (
+	conflictMerge        = "merge"         // match the union of both
+	conflictPreferSingle = "location_key"  // ignore location_keys
+	conflictPreferList   = "location_keys" // ignore location_key
+	conflictReject       = "reject"        // 400
+)
+
+// normalizeLocationKeysConflict validates LOCATION_KEYS_CONFLICT, defaulting to merge
+func normalizeLocationKeysConflict(behavior string) string {
+	switch behavior {
+	case conflictPreferSingle, conflictPreferList, conflictReject:
+		return behavior
+	}
+	return conflictMerge
+}
+
+// requestedKeys applies LOCATION_KEYS_CONFLICT to the singular and plural filters
+func (filter FilterRequest) requestedKeys() ([]string, error) {
+	if filter.LocationKey == "" || len(filter.LocationKeys) == 0 {
+		return append([]string{filter.LocationKey}, filter.LocationKeys...), nil
+	}
+	switch cfg.LocationKeysConflict {
+	case conflictPreferSingle:
+		return []string{filter.LocationKey}, nil
+	case conflictPreferList:
+		return filter.LocationKeys, nil
+	case conflictReject:
+		return nil, fmt.Errorf("location_key and location_keys cannot be combined")
+	}
+	return append([]string{filter.LocationKey}, filter.LocationKeys...), nil
+}
+
+// locationKeys resolves location_key and location_keys into one de-duplicated list,
+// rejecting requests that name more keys than MAX_LOCATION_KEYS allows
+func (filter FilterRequest) locationKeys() ([]interface{}, error) {
+	requested, err := filter.requestedKeys()
+	if err != nil {
+		return nil, err
+	}
+	var keys []interface{}
+	seen := map[string]bool{}
+	for _, key := range requested {
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		keys = append(keys, key)
+	}
+	if len(keys) > cfg.MaxLocationKeys {
+		return nil, fmt.Errorf("too many location keys: %d (maximum %d)", len(keys), cfg.MaxLocationKeys)
+	}
+	return keys, nil
+}
+
+// locationCondition returns the predicate matching any of keys and its single argument
+func locationCondition(keys []interface{}) (string, interface{}) {
+	if len(keys) == 1 {
+		return "location_key = ?", keys[0]
+	}
+	return "location_key IN ?", clickhouse.GroupSet{Value: keys}
+}
+
+// parseDateRange validates a required start/end pair and that start is not after end
+func parseDateRange(startField, start, endField, end string) (time.Time, time.Time, error) {
+	from, err := parseDate(start)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("%s: %w", startField, err)
+	}
+	to, err := parseDate(end)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("%s: %w", endField, err)
+	}
+	if from.After(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("%s must not be after %s", startField, endField)
+	}
+	return from, to, nil
+}
+
+// dedupe reports whether duplicate rows should be collapsed, defaulting to DEDUPE_READS.
+// Snapshots always collapse to the latest revision per row.
+func (filter FilterRequest) dedupe() bool {
+	if filter.asOfApplies() {
+		return true
+	}
+	if filter.Dedupe != nil {
+		return *filter.Dedupe
+	}
+	return cfg.DedupeReads
+}
+
+// asOfApplies reports whether the as_of snapshot can be honored: the table must be
+// versioned, i.e. keep each revision as its own row stamped with UPDATED_AT_COLUMN
+func (filter FilterRequest) asOfApplies() bool {
+	return filter.AsOf != "" && tableHasColumn(cfg.UpdatedAtColumn)
+}
+
+// readConditions returns the predicates every read of covid19 for the request applies:
+// future-dated rows are left out (see futureConditions) and, with as_of, rows are limited
+// to revisions ingested on or before it. Without a versioned table as_of is ignored and a
+// warning is added.
+func (filter FilterRequest) readConditions(c *fiber.Ctx) ([]string, []interface{}, error) {
+	conditions := futureConditions(c)
+	if filter.AsOf == "" {
+		return conditions, nil, nil
+	}
+	asOf, err := parseDate(filter.AsOf)
+	if err != nil {
+		return nil, nil, fmt.Errorf("as_of: %w", err)
+	}
+	if !filter.asOfApplies() {
+		addWarning(c, "as_of ignored: the covid19 table is not versioned")
+		return conditions, nil, nil
+	}
+	condition := "toDate(" + quoteIdentifier(cfg.UpdatedAtColumn) + ") <= ?"
+	return append(conditions, condition), []interface{}{asOf.Format(time.DateOnly)}, nil
+}
+
+// readSource returns the FROM target reading covid19 rows that match conditions.
+// The conditions are emitted as PREWHERE when enabled. With dedupe, duplicate
+// (location_key, date) rows are collapsed to the most recently updated one (an
+// arbitrary one when the table has no update column).
+func readSource(conditions []string, dedupe bool) string {
+	source := "covid19"
+	if len(conditions) > 0 {
+		keyword := "WHERE"
+		if cfg.UsePrewhere {
+			keyword = "PREWHERE"
+		}
+		source += " " + keyword + " " + joinConditions(conditions, " AND ")
+	}
+	if !dedupe {
+		return source
+	}
+	order := "location_key, date"
+	if tableHasColumn(cfg.UpdatedAtColumn) {
+		order += ", " + quoteIdentifier(cfg.UpdatedAtColumn) + " DESC"
+	}
+	return "(SELECT * FROM " + source + " ORDER BY " + order + " LIMIT 1 BY location_key, date)"
+}
+
+// countDuplicates returns how many rows matching conditions duplicate another row's (location_key, date)
+func countDuplicates(ctx context.Context, conditions []string, args []interface{}) (uint64, error) {
+	var duplicates uint64
+	query := "SELECT count() - uniqExact(location_key, date) FROM " + readSource(conditions, false)
+	err := db.QueryRow(ctx, query, args...).Scan(&duplicates)
+	return duplicates, err
+}
+
+// timeSeriesQuery builds the "latest row per location" read over the covid19 table
+type timeSeriesQuery struct {
+	columns      []string         // metric columns to project
+	computed     []computedColumn // extra projected expressions such as updated_at
+	dedupe       bool             // collapse duplicate (location_key, date) rows before the window
+	rankBy       string           // window ORDER BY choosing which rows of each location are kept
+	perLocation  int              // rows kept per location
+	prewhere     []string         // predicates evaluated while reading, before the window function
+	prewhereArgs []interface{}    // arguments for prewhere, in order
+	history      []string         // predicates selecting each location's full history, for per-location aggregates
+	historyArgs  []interface{}    // arguments for history, in order
+	firstCase    bool             // add days_since_first_case
+	monotonicity string           // monotonicityOff, monotonicityFlag or monotonicityExclude
+	movingSums   []string         // new_* columns summed over the trailing movingDays rows
+	movingDays   int              // window of movingSums
+	where        []string         // predicates applied to the latest row of each location
+	whereArgs    []interface{}    // arguments for where, in order
+}
+
+// newTimeSeriesQuery translates a filter request into a query, validating the requested fields
+func newTimeSeriesQuery(filter FilterRequest) (*timeSeriesQuery, error) {
+	columns, err := resolveFields(filter.Fields)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := filter.locationKeys()
+	if err != nil {
+		return nil, err
+	}
+	q := &timeSeriesQuery{columns: columns, dedupe: filter.dedupe(), rankBy: "date DESC", perLocation: 1}
+
+	// Location filters keep whole partitions of the window, so they can be pushed down
+	// into the read.
+	if len(keys) > 0 {
+		condition, arg := locationCondition(keys)
+		q.filterSource([]string{condition}, []interface{}{arg})
+	}
+
+	if filter.TopK != 0 {
+		if filter.TopK < 0 || filter.TopK > cfg.MaxTopK {
+			return nil, fmt.Errorf("top_k must be between 1 and %d", cfg.MaxTopK)
+		}
+		if !isMetricColumn(filter.TopMetric) {
+			return nil, fmt.Errorf("unknown top_metric %q", filter.TopMetric)
+		}
+		q.rankBy = filter.TopMetric + " DESC, date DESC"
+		q.perLocation = filter.TopK
+	}
+
+	if filter.StartDate != "" && filter.EndDate != "" {
+		if filter.TopK != 0 {
+			// Top-K ranks the days inside the range
+			q.prewhere = append(q.prewhere, "date BETWEEN ? AND ?")
+			q.prewhereArgs = append(q.prewhereArgs, filter.StartDate, filter.EndDate)
+		} else {
+			// The window has to see the full history to know which row is the latest one
+			q.where = append(q.where, "date BETWEEN ? AND ?")
+			q.whereArgs = append(q.whereArgs, filter.StartDate, filter.EndDate)
+		}
+	}
+
+	if filter.IncludePositivity || containsString(filter.Fields, "positivity") {
+		q.computed = append(q.computed, computedColumn{name: "positivity", expr: positivityExpr()})
+	}
+	if (filter.IncludeUpdatedAt || containsString(filter.Fields, "updated_at")) && tableHasColumn(cfg.UpdatedAtColumn) {
+		q.computed = append(q.computed, computedColumn{name: "updated_at", expr: quoteIdentifier(cfg.UpdatedAtColumn)})
+	}
+	q.firstCase = filter.IncludeDaysSinceFirstCase || containsString(filter.Fields, "days_since_first_case")
+	q.monotonicity = cfg.Monotonicity
+	if filter.Monotonicity != "" {
+		if q.monotonicity = normalizeMonotonicity(filter.Monotonicity); q.monotonicity != filter.Monotonicity {
+			return nil, fmt.Errorf("monotonicity must be off, flag or exclude, got %q", filter.Monotonicity)
+		}
+	}
+	if filter.MovingSumDays != 0 {
+		if err := validateMovingSumDays(filter.MovingSumDays); err != nil {
+			return nil, err
+		}
+		for _, column := range columns {
+			if strings.HasPrefix(column, "new_") {
+				q.movingSums = append(q.movingSums, column)
+			}
+		}
+		if len(q.movingSums) == 0 {
+			return nil, fmt.Errorf("moving_sum_days needs at least one new_* field")
+		}
+		q.movingDays = filter.MovingSumDays
+	}
+	return q, nil
+}
+
+// filterSource restricts both the rows read and the history used for per-location aggregates
+func (q *timeSeriesQuery) filterSource(conditions []string, args []interface{}) {
+	q.prewhere = append(q.prewhere, conditions...)
+	q.prewhereArgs = append(q.prewhereArgs, args...)
+	q.history = append(q.history, conditions...)
+	q.historyArgs = append(q.historyArgs, args...)
+}
+
+// Strategies for selecting the latest row of each location, see LATEST_ROW_STRATEGY
+const (
+	latestRowLimitBy = "limit_by" // ORDER BY location_key, date DESC LIMIT 1 BY location_key
+	latestRowWindow  = "window"   // ROW_NUMBER() OVER (PARTITION BY location_key ...) = 1
+)
+
+// normalizeLatestRowStrategy validates LATEST_ROW_STRATEGY, defaulting to limit_by
+func normalizeLatestRowStrategy(strategy string) string {
+	if strategy == latestRowWindow {
+		return strategy
+	}
+	return latestRowLimitBy
+}
+
+// computedFields are the non-metric fields a request may name
+var computedFields = []string{"positivity", "updated_at", "days_since_first_case", "decreasing_columns",
+	"new_confirmed_sum", "new_deceased_sum", "new_recovered_sum", "new_tested_sum"}
+
+// daysSinceFirstCaseExpr counts days from the location's first date with new_confirmed > 0,
+// or NULL when it has none. It is evaluated after joining first_cases.
+const daysSinceFirstCaseExpr = "if(first_cases.cases > 0, toInt32(dateDiff('day', first_cases.first_case, latest_data.date)), NULL)"
+
+// Monotonicity modes for cumulative columns, see MONOTONICITY
+const (
+	monotonicityOff     = "off"     // return every row unchecked
+	monotonicityFlag    = "flag"    // list the decreasing columns of each row
+	monotonicityExclude = "exclude" // drop rows with a decreasing cumulative column
+)
+
+// normalizeMonotonicity validates a monotonicity mode, defaulting to off
+func normalizeMonotonicity(mode string) string {
+	switch mode {
+	case monotonicityFlag, monotonicityExclude:
+		return mode
+	}
+	return monotonicityOff
+}
+
+// cumulativeColumns are the running totals that should never decrease
+var cumulativeColumns = []string{"cumulative_confirmed", "cumulative_deceased", "cumulative_recovered", "cumulative_tested"}
+
+// decreasesCTE lists each (location_key, date) whose cumulative values are lower than on
+// the location's previous reported day, with the names of the columns that decreased
+func decreasesCTE(source string) string {
+	var lags, checks []string
+	for _, column := range cumulativeColumns {
+		lags = append(lags, column, "lagInFrame("+column+") OVER w AS prev_"+column)
+		checks = append(checks, "if("+column+" < prev_"+column+", '"+column+"', '')")
+	}
+	return `
+	decreases AS (
+		SELECT location_key, date,
+			   arrayFilter(c -> c != '', [` + join(checks, ", ") + `]) AS decreased
+		FROM (
+			SELECT location_key, date, row_number() OVER w AS rn,
+				   ` + join(lags, ", ") + `
+			FROM ` + source + `
+			WINDOW w AS (PARTITION BY location_key ORDER BY date ROWS BETWEEN 1 PRECEDING AND CURRENT ROW)
+		)
+		WHERE rn > 1 AND notEmpty(decreased)
+	)`
+}
+
+// computedColumn is an extra projected expression, evaluated inside the window CTE
+type computedColumn struct {
+	name string
+	expr string
+}
+
+// joinedColumns are the projected expressions evaluated after the per-location joins
+func (q *timeSeriesQuery) joinedColumns() []computedColumn {
+	var columns []computedColumn
+	if q.firstCase {
+		columns = append(columns, computedColumn{name: "days_since_first_case", expr: daysSinceFirstCaseExpr})
+	}
+	if q.monotonicity == monotonicityFlag {
+		columns = append(columns, computedColumn{name: "decreasing_columns", expr: "decreases.decreased"})
+	}
+	for _, column := range q.movingSums {
+		columns = append(columns, computedColumn{name: movingSumColumn(column), expr: "moving_sums." + movingSumColumn(column)})
+	}
+	return columns
+}
+
+// selectColumns returns every column projected by the query, key columns first
+func (q *timeSeriesQuery) selectColumns() []string {
+	columns := append([]string{"location_key", "date"}, q.columns...)
+	for _, c := range q.computed {
+		columns = append(columns, c.name)
+	}
+	for _, c := range q.joinedColumns() {
+		columns = append(columns, c.name)
+	}
+	return columns
+}
+
+// build renders the SQL text and its positional arguments
+func (q *timeSeriesQuery) build() (string, []interface{}) {
+	outer := append([]string{"location_key", "date"}, q.columns...)
+	inner := append([]string{"location_key", "date"}, q.columns...)
+	for _, c := range q.computed {
+		outer = append(outer, c.name)
+		inner = append(inner, c.expr+" AS "+c.name)
+	}
+	for _, c := range q.joinedColumns() {
+		outer = append(outer, c.expr+" AS "+c.name)
+	}
+
+	// CTEs are rendered in order, so their arguments are collected in the same order
+	var ctes []string
+	var args []interface{}
+	if q.monotonicity != monotonicityOff {
+		// Decreases are judged against the full history, not just the requested window
+		ctes = append(ctes, decreasesCTE(readSource(q.history, q.dedupe)))
+		args = append(args, q.historyArgs...)
+	}
+	prewhere := append([]string{}, q.prewhere...)
+	if q.monotonicity == monotonicityExclude {
+		// Excluded before the latest row is chosen, so the latest valid row is returned
+		prewhere = append(prewhere, "(location_key, date) NOT IN (SELECT location_key, date FROM decreases)")
+	}
+
+	// LIMIT BY keeps the first row of each location after sorting by the table's own key
+	// order, avoiding the window function's full sort; top-K still needs rn for ordering
+	limitBy := q.perLocation == 1 && cfg.LatestRowStrategy == latestRowLimitBy
+	if limitBy {
+		ctes = append(ctes, `
+	latest_data AS (
+		SELECT `+join(inner, ",\n\t\t\t   ")+`
+		FROM `+readSource(prewhere, q.dedupe)+`
+		ORDER BY location_key, `+q.rankBy+`
+		LIMIT 1 BY location_key
+	)`)
+	} else {
+		ctes = append(ctes, `
+	latest_data AS (
+		SELECT `+join(inner, ",\n\t\t\t   ")+`,
+			   ROW_NUMBER() OVER (PARTITION BY location_key ORDER BY `+q.rankBy+`) AS rn
+		FROM `+readSource(prewhere, q.dedupe)+`
+	)`)
+	}
+	args = append(args, q.prewhereArgs...)
+	if q.firstCase {
+		// The first case is looked up over the full history, not just the requested window
+		ctes = append(ctes, `
+	first_cases AS (
+		SELECT location_key,
+			   minIf(date, new_confirmed > 0) AS first_case,
+			   countIf(new_confirmed > 0) AS cases
+		FROM `+readSource(q.history, q.dedupe)+`
+		GROUP BY location_key
+	)`)
+		args = append(args, q.historyArgs...)
+	}
+	if len(q.movingSums) > 0 {
+		// Sums are taken over the full history, so the first rows of a range are complete
+		ctes = append(ctes, movingSumsCTE(readSource(q.history, q.dedupe), q.movingSums, q.movingDays))
+		args = append(args, q.historyArgs...)
+	}
+
+	query := `
+	WITH ` + strings.TrimLeft(join(ctes, ","), "\n\t") + `
+	SELECT ` + join(outer, ",\n\t\t\t   ") + `
+	FROM latest_data`
+	if q.firstCase {
+		query += "\n\tLEFT JOIN first_cases USING (location_key)"
+	}
+	if q.monotonicity == monotonicityFlag {
+		query += "\n\tLEFT JOIN decreases USING (location_key, date)"
+	}
+	if len(q.movingSums) > 0 {
+		query += "\n\tLEFT JOIN moving_sums USING (location_key, date)"
+	}
+	var where []string
+	switch {
+	case limitBy:
+		// LIMIT BY already kept one row per location
+	case q.perLocation == 1:
+		where = append(where, "rn = 1")
+	default:
+		where = append(where, fmt.Sprintf("rn <= %d", q.perLocation))
+	}
+	if len(q.where) > 0 {
+		where = append(where, joinConditions(q.where, " AND "))
+	}
+	if len(where) > 0 {
+		query += "\n\tWHERE " + join(where, " AND ")
+	}
+	if q.perLocation > 1 {
+		query += "\n\tORDER BY location_key, rn"
+	}
+
+	args = append(args, q.whereArgs...)
+	return query, args
+}
+
+// scanDest returns pointers into ts matching the given column order
+func (ts *TimeSeriesData) scanDest(columns []string) []interface{} {
+	dest := make([]interface{}, len(columns))
+	for i, column := range columns {
+		switch column {
+		case "location_key":
+			dest[i] = &ts.LocationKey
+		case "date":
+			dest[i] = &ts.Date.Time
+		case "new_confirmed":
+			dest[i] = &ts.NewConfirmed
+		case "new_deceased":
+			dest[i] = &ts.NewDeceased
+		case "new_recovered":
+			dest[i] = &ts.NewRecovered
+		case "new_tested":
+			dest[i] = &ts.NewTested
+		case "cumulative_confirmed":
+			dest[i] = &ts.CumulativeConfirmed
+		case "cumulative_deceased":
+			dest[i] = &ts.CumulativeDeceased
+		case "cumulative_recovered":
+			dest[i] = &ts.CumulativeRecovered
+		case "cumulative_tested":
+			dest[i] = &ts.CumulativeTested
+		case "positivity":
+			dest[i] = &ts.Positivity
+		case "updated_at":
+			dest[i] = &ts.UpdatedAt
+		case "days_since_first_case":
+			ts.DaysSinceFirstCase = new(*int32)
+			dest[i] = ts.DaysSinceFirstCase
+		case "decreasing_columns":
+			dest[i] = &ts.DecreasingColumns
+		case "new_confirmed_sum":
+			ts.NewConfirmedSum = new(*int64)
+			dest[i] = ts.NewConfirmedSum
+		case "new_deceased_sum":
+			ts.NewDeceasedSum = new(*int64)
+			dest[i] = ts.NewDeceasedSum
+		case "new_recovered_sum":
+			ts.NewRecoveredSum = new(*int64)
+			dest[i] = ts.NewRecoveredSum
+		case "new_tested_sum":
+			ts.NewTestedSum = new(*int64)
+			dest[i] = ts.NewTestedSum
+		}
+	}
+	return dest
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// keyList returns n distinct location keys
+func keyList(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("K%d", i)
+	}
+	return keys
+}
+
+func TestLocationKeysLimit(t *testing.T) {
+	defer func(old int) { cfg.MaxLocationKeys = old }(cfg.MaxLocationKeys)
+	cfg.MaxLocationKeys = 3
+	tests := []struct {
+		name    string
+		filter  FilterRequest
+		want    int
+		wantErr bool
+	}{
+		{"none", FilterRequest{}, 0, false},
+		{"below the limit", FilterRequest{LocationKeys: keyList(2)}, 2, false},
+		{"at the limit", FilterRequest{LocationKeys: keyList(3)}, 3, false},
+		{"above the limit", FilterRequest{LocationKeys: keyList(4)}, 0, true},
+		{"duplicates do not count", FilterRequest{LocationKeys: append(keyList(3), "K0", "K1")}, 3, false},
+		{"location_key counts towards the limit", FilterRequest{LocationKey: "US", LocationKeys: keyList(3)}, 0, true},
+		{"location_key repeated in the list", FilterRequest{LocationKey: "K0", LocationKeys: keyList(3)}, 3, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := tt.filter.locationKeys()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(keys) != tt.want {
+				t.Errorf("got %d keys %v, want %d", len(keys), keys, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestedKeysCombined(t *testing.T) {
+	defer func(old string) { cfg.LocationKeysConflict = old }(cfg.LocationKeysConflict)
+	combined := FilterRequest{LocationKey: "US", LocationKeys: []string{"FR", "DE"}}
+	tests := []struct {
+		behavior string
+		want     []string
+		wantErr  bool
+	}{
+		{conflictMerge, []string{"US", "FR", "DE"}, false},
+		{conflictPreferSingle, []string{"US"}, false},
+		{conflictPreferList, []string{"FR", "DE"}, false},
+		{conflictReject, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.behavior, func(t *testing.T) {
+			cfg.LocationKeysConflict = tt.behavior
+			got, err := combined.requestedKeys()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Either filter alone is used as is, whatever the behavior
+	cfg.LocationKeysConflict = conflictReject
+	for _, filter := range []FilterRequest{{LocationKey: "US"}, {LocationKeys: []string{"FR", "DE"}}} {
+		keys, err := filter.locationKeys()
+		if err != nil || len(keys) == 0 {
+			t.Errorf("%+v: keys %v, err %v", filter, keys, err)
+		}
+	}
+}
+
+func TestTimeSeriesQueryTopK(t *testing.T) {
+	filter := FilterRequest{
+		LocationKeys: []string{"US", "FR"}, TopK: 3, TopMetric: "new_confirmed",
+		StartDate: "2021-01-01", EndDate: "2021-03-31", Fields: []string{"new_confirmed"},
+	}
+	q, err := newTimeSeriesQuery(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, args := q.build()
+	for _, want := range []string{
+		"ROW_NUMBER() OVER (PARTITION BY location_key ORDER BY new_confirmed DESC, date DESC) AS rn",
+		"WHERE rn <= 3",
+		"ORDER BY location_key, rn",
+	} {
+		if !strings.Contains(query, want) {
+			t.Errorf("query lacks %q:\n%s", want, query)
+		}
+	}
+	// Top-K ranks the days inside the range, so the range is applied before ranking
+	if strings.Contains(query, "LIMIT 1 BY") || strings.Index(query, "date BETWEEN ? AND ?") > strings.Index(query, "FROM latest_data") {
+		t.Errorf("range not applied before ranking:\n%s", query)
+	}
+	if len(args) != 3 {
+		t.Errorf("args = %v, want the location set and the range", args)
+	}
+
+	for _, k := range []int{-1, cfg.MaxTopK + 1} {
+		if _, err := newTimeSeriesQuery(FilterRequest{TopK: k, TopMetric: "new_confirmed"}); err == nil {
+			t.Errorf("top_k %d accepted", k)
+		}
+	}
+	if _, err := newTimeSeriesQuery(FilterRequest{TopK: 3, TopMetric: "nope"}); err == nil {
+		t.Error("unknown top_metric accepted")
+	}
+}
+
+// TestLatestRowStrategies checks that LIMIT 1 BY only replaces how the latest row is
+// chosen: both plans read the same source with the same arguments, and apply the date
+// range to the chosen row
+func TestLatestRowStrategies(t *testing.T) {
+	defer func(old string) { cfg.LatestRowStrategy = old }(cfg.LatestRowStrategy)
+	if got := normalizeLatestRowStrategy(""); got != latestRowLimitBy {
+		t.Errorf("default LATEST_ROW_STRATEGY = %q, want %q", got, latestRowLimitBy)
+	}
+	filter := FilterRequest{
+		LocationKeys: []string{"US", "FR"}, StartDate: "2021-01-01", EndDate: "2021-03-31",
+		Fields: []string{"new_confirmed"},
+	}
+	build := func(strategy string) (string, []interface{}) {
+		cfg.LatestRowStrategy = strategy
+		q, err := newTimeSeriesQuery(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return q.build()
+	}
+	window, windowArgs := build(latestRowWindow)
+	limitBy, limitByArgs := build(latestRowLimitBy)
+
+	for query, want := range map[string][]string{
+		window:  {"ROW_NUMBER() OVER (PARTITION BY location_key ORDER BY date DESC) AS rn", "WHERE rn = 1 AND (date BETWEEN ? AND ?)"},
+		limitBy: {"ORDER BY location_key, date DESC\n\t\tLIMIT 1 BY location_key", "WHERE (date BETWEEN ? AND ?)"},
+	} {
+		for _, w := range want {
+			if !strings.Contains(query, w) {
+				t.Errorf("query lacks %q:\n%s", w, query)
+			}
+		}
+	}
+	if strings.Contains(limitBy, "rn") {
+		t.Errorf("LIMIT BY query still ranks rows:\n%s", limitBy)
+	}
+	// Apart from choosing the row, the queries read and return the same
+	source := "FROM covid19 PREWHERE (location_key IN ?)"
+	outer := func(query string) string { return query[strings.Index(query, "\n\t)"):] }
+	if !strings.Contains(window, source) || !strings.Contains(limitBy, source) {
+		t.Errorf("strategies read different sources:\n%s\n%s", window, limitBy)
+	}
+	if got, want := outer(limitBy), strings.Replace(outer(window), "rn = 1 AND ", "", 1); got != want {
+		t.Errorf("outer query = %s, want %s", got, want)
+	}
+	if fmt.Sprint(limitByArgs) != fmt.Sprint(windowArgs) {
+		t.Errorf("LIMIT BY args = %v, window args = %v", limitByArgs, windowArgs)
+	}
+}
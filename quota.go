@@ -0,0 +1,186 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// quota is the number of requests an API key may make per UTC day and month; 0 is unlimited
+type quota struct {
+	Daily   int
+	Monthly int
+}
+
+// parseQuotas reads API_KEY_QUOTAS entries of the form "key=daily/monthly" (either side may
+// be empty or 0 for no limit) into quotas keyed by consumer id, so raw keys are not kept
+func parseQuotas(entries []string) map[string]quota {
+	quotas := map[string]quota{}
+	for _, entry := range entries {
+		key, limits, ok := strings.Cut(entry, "=")
+		daily, monthly, _ := strings.Cut(limits, "/")
+		q, err := parseQuota(daily, monthly)
+		if !ok || key == "" || err != nil {
+			log.Printf("ignoring invalid API_KEY_QUOTAS entry for key %q", keyID(key))
+			continue
+		}
+		quotas[keyID(strings.TrimSpace(key))] = q
+	}
+	return quotas
+}
+
+// parseQuota parses the daily and monthly limits of one quota entry
+func parseQuota(daily, monthly string) (quota, error) {
+	var q quota
+	var err error
+	if daily = strings.TrimSpace(daily); daily != "" {
+		if q.Daily, err = strconv.Atoi(daily); err != nil {
+			return q, err
+		}
+	}
+	if monthly = strings.TrimSpace(monthly); monthly != "" {
+		if q.Monthly, err = strconv.Atoi(monthly); err != nil {
+			return q, err
+		}
+	}
+	return q, nil
+}
+
+// quotaFor returns the quota of a consumer, falling back to the defaults for unlisted ones
+func quotaFor(consumer string) quota {
+	if q, ok := cfg.APIKeyQuotas[consumer]; ok {
+		return q
+	}
+	return quota{Daily: cfg.DefaultDailyQuota, Monthly: cfg.DefaultMonthlyQuota}
+}
+
+// quotaUsage counts one consumer's requests in the current day and month
+type quotaUsage struct {
+	Day     string
+	Daily   int
+	Month   string
+	Monthly int
+}
+
+// quotaCounters holds the in-memory usage of every consumer counted in the current month
+var quotaCounters = struct {
+	sync.Mutex
+	usage map[string]*quotaUsage
+	swept string // day of the last evictQuotaCounters
+}{usage: map[string]*quotaUsage{}}
+
+// quotaNow is the clock quota windows are counted by
+var quotaNow = time.Now
+
+// quotaConsumer returns who a request is counted as and its quota: an API key listed in
+// API_KEY_QUOTAS, or otherwise the client IP under the DEFAULT_*_QUOTA values. Requests
+// without a key and with an unlisted one are counted alike, so making up a key does not
+// buy a fresh counter.
+func quotaConsumer(c *fiber.Ctx) (string, quota) {
+	if consumer := knownConsumerID(c); consumer != "anon" {
+		return consumer, cfg.APIKeyQuotas[consumer]
+	}
+	return "ip:" + c.IP(), quota{Daily: cfg.DefaultDailyQuota, Monthly: cfg.DefaultMonthlyQuota}
+}
+
+// enforceQuota counts requests against the consumer's quota, answering 429 once either
+// the daily or monthly limit is used up. Every counted response reports the tighter
+// window in X-RateLimit-Limit / -Remaining / -Reset.
+func enforceQuota(c *fiber.Ctx) error {
+	consumer, q := quotaConsumer(c)
+	if q.Daily <= 0 && q.Monthly <= 0 {
+		return c.Next()
+	}
+
+	now := quotaNow().UTC()
+	day, month := now.Format(time.DateOnly), now.Format("2006-01")
+	quotaCounters.Lock()
+	if quotaCounters.swept != day {
+		evictQuotaCounters(day, month)
+	}
+	u, ok := quotaCounters.usage[consumer]
+	if !ok {
+		u = &quotaUsage{}
+		quotaCounters.usage[consumer] = u
+	}
+	// Windows reset when the first request of a new UTC day or month arrives
+	if u.Day != day {
+		u.Day, u.Daily = day, 0
+	}
+	if u.Month != month {
+		u.Month, u.Monthly = month, 0
+	}
+	exceeded := (q.Daily > 0 && u.Daily >= q.Daily) || (q.Monthly > 0 && u.Monthly >= q.Monthly)
+	if !exceeded {
+		u.Daily++
+		u.Monthly++
+	}
+	limit, remaining, reset := tightestWindow(q, *u, now)
+	quotaCounters.Unlock()
+
+	c.Set("X-RateLimit-Limit", strconv.Itoa(limit))
+	c.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	c.Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	if exceeded {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(reset.Sub(now).Seconds())+1))
+		return c.Status(http.StatusTooManyRequests).JSON(fiber.Map{"error": "API key quota exceeded"})
+	}
+	return c.Next()
+}
+
+// evictQuotaCounters drops the counters that no longer limit anything: those last used
+// in an earlier month, and those of an earlier day whose consumer has no monthly limit.
+// It runs on the first counted request of each UTC day; callers hold quotaCounters.
+func evictQuotaCounters(day, month string) {
+	for consumer, u := range quotaCounters.usage {
+		if u.Month != month || (u.Day != day && quotaFor(consumer).Monthly <= 0) {
+			delete(quotaCounters.usage, consumer)
+		}
+	}
+	quotaCounters.swept = day
+}
+
+// tightestWindow returns the limit, remaining requests and reset time of whichever
+// limited window has the fewest requests left, the monthly one on a tie since the daily
+// reset would then not free any requests
+func tightestWindow(q quota, u quotaUsage, now time.Time) (int, int, time.Time) {
+	nextDay := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	nextMonth := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	if q.Monthly <= 0 || (q.Daily > 0 && q.Daily-u.Daily < q.Monthly-u.Monthly) {
+		return q.Daily, max(q.Daily-u.Daily, 0), nextDay
+	}
+	return q.Monthly, max(q.Monthly-u.Monthly, 0), nextMonth
+}
+
+// QuotaStatus is one consumer's quota and current usage
+type QuotaStatus struct {
+	Consumer     string `json:"consumer"`
+	Day          string `json:"day"`
+	DailyUsed    int    `json:"daily_used"`
+	DailyLimit   int    `json:"daily_limit"`
+	Month        string `json:"month"`
+	MonthlyUsed  int    `json:"monthly_used"`
+	MonthlyLimit int    `json:"monthly_limit"`
+}
+
+// getQuotas handles GET /api/admin/quotas, listing the usage counted since startup
+func getQuotas(c *fiber.Ctx) error {
+	quotaCounters.Lock()
+	statuses := make([]QuotaStatus, 0, len(quotaCounters.usage))
+	for consumer, u := range quotaCounters.usage {
+		q := quotaFor(consumer)
+		statuses = append(statuses, QuotaStatus{
+			Consumer: consumer, Day: u.Day, DailyUsed: u.Daily, DailyLimit: q.Daily,
+			Month: u.Month, MonthlyUsed: u.Monthly, MonthlyLimit: q.Monthly,
+		})
+	}
+	quotaCounters.Unlock()
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Consumer < statuses[j].Consumer })
+	return sendJSON(c, statuses)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// useQuotas sets the configured quotas and clears the counters for the rest of the test,
+// with quota windows following the returned clock
+func useQuotas(t *testing.T, keys map[string]quota, daily, monthly int) *time.Time {
+	t.Helper()
+	oldKeys, oldDaily, oldMonthly, oldNow := cfg.APIKeyQuotas, cfg.DefaultDailyQuota, cfg.DefaultMonthlyQuota, quotaNow
+	t.Cleanup(func() {
+		cfg.APIKeyQuotas, cfg.DefaultDailyQuota, cfg.DefaultMonthlyQuota, quotaNow = oldKeys, oldDaily, oldMonthly, oldNow
+		quotaCounters.usage, quotaCounters.swept = map[string]*quotaUsage{}, ""
+	})
+	cfg.APIKeyQuotas, cfg.DefaultDailyQuota, cfg.DefaultMonthlyQuota = keys, daily, monthly
+	quotaCounters.usage, quotaCounters.swept = map[string]*quotaUsage{}, ""
+	now := new(time.Time)
+	quotaNow = func() time.Time { return *now }
+	return now
+}
+
+// at parses an RFC 3339 time in a test table
+func at(t *testing.T, value string) time.Time {
+	t.Helper()
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestEnforceQuota(t *testing.T) {
+	type step struct {
+		at         string
+		status     int
+		limit      int
+		remaining  int
+		reset      string
+		retryAfter string // expected Retry-After, "" when none
+	}
+	tests := []struct {
+		name  string
+		quota quota
+		steps []step
+	}{
+		{"daily limit", quota{Daily: 2}, []step{
+			{"2021-03-05T10:00:00Z", 200, 2, 1, "2021-03-06T00:00:00Z", ""},
+			{"2021-03-05T11:00:00Z", 200, 2, 0, "2021-03-06T00:00:00Z", ""},
+			{"2021-03-05T14:00:00Z", 429, 2, 0, "2021-03-06T00:00:00Z", "36001"},
+			{"2021-03-05T23:59:59Z", 429, 2, 0, "2021-03-06T00:00:00Z", "2"},
+		}},
+		{"rollover at UTC midnight", quota{Daily: 1}, []step{
+			{"2021-03-05T23:59:59Z", 200, 1, 0, "2021-03-06T00:00:00Z", ""},
+			{"2021-03-05T23:59:59Z", 429, 1, 0, "2021-03-06T00:00:00Z", "2"},
+			{"2021-03-06T00:00:00Z", 200, 1, 0, "2021-03-07T00:00:00Z", ""},
+			{"2021-03-06T00:00:01Z", 429, 1, 0, "2021-03-07T00:00:00Z", "86400"},
+		}},
+		{"rollover at month end", quota{Monthly: 2}, []step{
+			{"2021-02-01T00:00:00Z", 200, 2, 1, "2021-03-01T00:00:00Z", ""},
+			{"2021-02-28T12:00:00Z", 200, 2, 0, "2021-03-01T00:00:00Z", ""},
+			{"2021-02-28T23:59:58Z", 429, 2, 0, "2021-03-01T00:00:00Z", "3"},
+			{"2021-03-01T00:00:00Z", 200, 2, 1, "2021-04-01T00:00:00Z", ""},
+		}},
+		{"rollover at year end", quota{Daily: 5, Monthly: 1}, []step{
+			{"2021-12-31T23:00:00Z", 200, 1, 0, "2022-01-01T00:00:00Z", ""},
+			{"2021-12-31T23:30:00Z", 429, 1, 0, "2022-01-01T00:00:00Z", "1801"},
+			{"2022-01-01T00:00:00Z", 200, 1, 0, "2022-02-01T00:00:00Z", ""},
+		}},
+		{"monthly limit outlasts the day", quota{Daily: 1, Monthly: 2}, []step{
+			{"2021-03-05T10:00:00Z", 200, 1, 0, "2021-03-06T00:00:00Z", ""},
+			{"2021-03-05T11:00:00Z", 429, 1, 0, "2021-03-06T00:00:00Z", "46801"},
+			{"2021-03-06T10:00:00Z", 200, 2, 0, "2021-04-01T00:00:00Z", ""},
+			{"2021-03-07T10:00:00Z", 429, 2, 0, "2021-04-01T00:00:00Z", "2124001"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := useQuotas(t, map[string]quota{keyID("k1"): tt.quota}, 0, 0)
+			app := fiber.New()
+			app.Use(enforceQuota)
+			app.Get("/", func(c *fiber.Ctx) error { return c.SendString("ok") })
+			for i, s := range tt.steps {
+				*now = at(t, s.at)
+				req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+				req.Header.Set("X-API-Key", "k1")
+				resp, err := app.Test(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := []string{
+					strconv.Itoa(resp.StatusCode), resp.Header.Get("X-RateLimit-Limit"), resp.Header.Get("X-RateLimit-Remaining"),
+					resp.Header.Get("X-RateLimit-Reset"), resp.Header.Get(fiber.HeaderRetryAfter),
+				}
+				want := []string{
+					strconv.Itoa(s.status), strconv.Itoa(s.limit), strconv.Itoa(s.remaining),
+					strconv.FormatInt(at(t, s.reset).Unix(), 10), s.retryAfter,
+				}
+				for j := range want {
+					if got[j] != want[j] {
+						t.Errorf("step %d at %s: status, limit, remaining, reset, Retry-After = %q, want %q", i, s.at, got, want)
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEnforceQuotaUnlimited(t *testing.T) {
+	now := useQuotas(t, nil, 0, 0)
+	*now = at(t, "2021-03-05T10:00:00Z")
+	app := fiber.New()
+	app.Use(enforceQuota)
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusOK || resp.Header.Get("X-RateLimit-Limit") != "" || len(quotaCounters.usage) != 0 {
+		t.Errorf("unlimited request: status %d, X-RateLimit-Limit %q, %d counters", resp.StatusCode, resp.Header.Get("X-RateLimit-Limit"), len(quotaCounters.usage))
+	}
+}
+
+func TestEvictQuotaCounters(t *testing.T) {
+	monthly, daily := keyID("monthly"), "ip:192.0.2.1"
+	tests := []struct {
+		name       string
+		day, month string
+		want       []string
+	}{
+		{"same day", "2021-03-05", "2021-03", []string{daily, monthly}},
+		{"next day", "2021-03-06", "2021-03", []string{monthly}},
+		{"month end", "2021-03-31", "2021-03", []string{monthly}},
+		{"next month", "2021-04-01", "2021-04", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useQuotas(t, map[string]quota{monthly: {Daily: 10, Monthly: 100}}, 5, 0)
+			quotaCounters.usage = map[string]*quotaUsage{
+				monthly: {Day: "2021-03-05", Daily: 3, Month: "2021-03", Monthly: 30},
+				daily:   {Day: "2021-03-05", Daily: 4, Month: "2021-03", Monthly: 4},
+			}
+			evictQuotaCounters(tt.day, tt.month)
+			got := []string{}
+			for consumer := range quotaCounters.usage {
+				got = append(got, consumer)
+			}
+			sort.Strings(got)
+			if len(got) != len(tt.want) || (len(got) > 0 && got[0] != tt.want[0]) || (len(got) > 1 && got[1] != tt.want[1]) {
+				t.Errorf("counters kept = %v, want %v", got, tt.want)
+			}
+			if quotaCounters.swept != tt.day {
+				t.Errorf("swept = %q, want %q", quotaCounters.swept, tt.day)
+			}
+		})
+	}
+}
+
+// TestEnforceQuotaEvicts checks that the first request of a new UTC day drops the
+// counters of other consumers that no longer limit anything
+func TestEnforceQuotaEvicts(t *testing.T) {
+	now := useQuotas(t, map[string]quota{keyID("a"): {Daily: 5}, keyID("b"): {Daily: 5}}, 0, 0)
+	app := fiber.New()
+	app.Use(enforceQuota)
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	request := func(key string) {
+		req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+		req.Header.Set("X-API-Key", key)
+		if _, err := app.Test(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	*now = at(t, "2021-03-05T10:00:00Z")
+	request("a")
+	request("b")
+	if len(quotaCounters.usage) != 2 {
+		t.Fatalf("%d counters on the first day, want 2", len(quotaCounters.usage))
+	}
+	*now = at(t, "2021-03-06T00:00:00Z")
+	request("b")
+	if u, ok := quotaCounters.usage[keyID("b")]; len(quotaCounters.usage) != 1 || !ok || u.Daily != 1 {
+		t.Errorf("counters on the next day = %v, want only b's with one request", quotaCounters.usage)
+	}
+}
+
+func TestTightestWindow(t *testing.T) {
+	now := time.Date(2021, 12, 15, 12, 0, 0, 0, time.UTC)
+	nextDay, nextMonth := time.Date(2021, 12, 16, 0, 0, 0, 0, time.UTC), time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		q         quota
+		u         quotaUsage
+		limit     int
+		remaining int
+		reset     time.Time
+	}{
+		{"daily only", quota{Daily: 10}, quotaUsage{Daily: 3, Monthly: 50}, 10, 7, nextDay},
+		{"monthly only", quota{Monthly: 100}, quotaUsage{Daily: 3, Monthly: 50}, 100, 50, nextMonth},
+		{"daily tighter", quota{Daily: 10, Monthly: 100}, quotaUsage{Daily: 3, Monthly: 50}, 10, 7, nextDay},
+		{"monthly tighter", quota{Daily: 10, Monthly: 100}, quotaUsage{Daily: 3, Monthly: 95}, 100, 5, nextMonth},
+		{"tie prefers monthly", quota{Daily: 10, Monthly: 100}, quotaUsage{Daily: 10, Monthly: 100}, 100, 0, nextMonth},
+		{"overused", quota{Daily: 10}, quotaUsage{Daily: 12}, 10, 0, nextDay},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit, remaining, reset := tightestWindow(tt.q, tt.u, now)
+			if limit != tt.limit || remaining != tt.remaining || !reset.Equal(tt.reset) {
+				t.Errorf("tightestWindow = %d, %d, %v, want %d, %d, %v", limit, remaining, reset, tt.limit, tt.remaining, tt.reset)
+			}
+		})
+	}
+}
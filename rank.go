@@ -0,0 +1,100 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RankRequest asks where a location stands among all locations for a metric on a date
+type RankRequest struct {
+	LocationKey string `json:"location_key"` // Required
+	Metric      string `json:"metric"`       // Required: metric column to rank by
+	Date        string `json:"date"`         // Required
+	AsOf        string `json:"as_of,omitempty"`
+	Dedupe      *bool  `json:"dedupe,omitempty"`
+	DateFormat  string `json:"date_format,omitempty"`
+}
+
+// RankData is a location's position for a metric on one day, highest value first
+type RankData struct {
+	LocationKey string `json:"location_key"`
+	Metric      string `json:"metric"`
+	Date        Date   `json:"date"`
+	Value       int32  `json:"value"`
+	Rank        uint64 `json:"rank"`  // 1 is the highest value; tied locations share a rank
+	Tied        uint64 `json:"tied"`  // locations with the same value, this one included
+	Total       uint64 `json:"total"` // locations with a row on the date
+}
+
+// validate checks the location, metric and date
+func (r RankRequest) validate() error {
+	if r.LocationKey == "" {
+		return errors.New("location_key is required")
+	}
+	if !isMetricColumn(r.Metric) {
+		return fmt.Errorf("unknown metric %q", r.Metric)
+	}
+	if _, err := parseDate(r.Date); err != nil {
+		return fmt.Errorf("date: %w", err)
+	}
+	return nil
+}
+
+// getRank handles POST /api/rank. Locations are ranked by the metric's value on the date,
+// highest first, with competition ranking for ties: equal values share the best rank and
+// the next value skips the tied places (1, 2, 2, 4). Only locations with a row on the
+// date are ranked.
+func getRank(c *fiber.Ctx) error {
+	var req RankRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid filter parameters"})
+	}
+	if err := req.validate(); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	filter := FilterRequest{LocationKey: req.LocationKey, AsOf: req.AsOf, Dedupe: req.Dedupe}
+	format, err := resolveDateFormat(c, req.DateFormat)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	reads, readArgs, err := filter.readConditions(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	date, _ := parseDate(req.Date)
+	day := date.Format(time.DateOnly)
+	recordUsageFilter(c, []interface{}{req.LocationKey}, day, day)
+
+	conditions := append([]string{"date = ?"}, reads...)
+	args := append([]interface{}{day}, readArgs...)
+	query := `
+	SELECT location_key, value, rank, tied, total
+	FROM (
+		SELECT location_key, value,
+			   rank() OVER (ORDER BY value DESC) AS rank,
+			   count() OVER (PARTITION BY value) AS tied,
+			   count() OVER () AS total
+		FROM (
+			SELECT location_key, ` + req.Metric + ` AS value
+			FROM ` + readSource(conditions, filter.dedupe()) + `
+		)
+	)
+	WHERE location_key = ?`
+	args = append(args, req.LocationKey)
+
+	result := RankData{Metric: req.Metric, Date: Date{Time: date, format: format}}
+	err = db.QueryRow(c.UserContext(), query, args...).Scan(&result.LocationKey, &result.Value, &result.Rank, &result.Tied, &result.Total)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "No row for " + req.LocationKey + " on " + day})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Query execution failed: " + err.Error()})
+	}
+
+	return respond(c, result)
+}
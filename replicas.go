@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// replicaPool spreads queries over one connection pool per CLICKHOUSE_ADDRS replica,
+// round robin. A read that fails because its replica could not be reached is retried on
+// the following replicas (see REPLICA_RETRY); a failure of the query itself is returned
+// as is. Writes are not retried, since a write cut off mid-flight may still have landed.
+type replicaPool struct {
+	addrs    []string
+	replicas []clickhouse.Conn
+	next     atomic.Uint32
+}
+
+// start picks the replica a query tries first
+func (p *replicaPool) start() int {
+	return int(p.next.Add(1)-1) % len(p.replicas)
+}
+
+// read runs fn against the replicas in turn, starting at the next one, until it succeeds,
+// fails for a reason other than an unreachable replica, or every replica has been tried
+func (p *replicaPool) read(ctx context.Context, fn func(clickhouse.Conn) error) error {
+	first := p.start()
+	var err error
+	for attempt := range p.replicas {
+		i := (first + attempt) % len(p.replicas)
+		if err = fn(p.replicas[i]); err == nil || !cfg.ReplicaRetry || ctx.Err() != nil || !isReplicaFailure(err) {
+			return err
+		}
+		if attempt < len(p.replicas)-1 {
+			replicaRetries.WithLabelValues(p.addrs[i]).Inc()
+			logContextf(ctx, "replica %s unreachable, retrying on the next one: %v", p.addrs[i], err)
+		}
+	}
+	return err
+}
+
+func (p *replicaPool) Contributors() []string { return p.replicas[0].Contributors() }
+
+func (p *replicaPool) ServerVersion() (*driver.ServerVersion, error) {
+	var version *driver.ServerVersion
+	err := p.read(context.Background(), func(conn clickhouse.Conn) (err error) {
+		version, err = conn.ServerVersion()
+		return err
+	})
+	return version, err
+}
+
+func (p *replicaPool) Select(ctx context.Context, dest any, query string, args ...any) error {
+	return p.read(ctx, func(conn clickhouse.Conn) error {
+		return conn.Select(ctx, dest, query, args...)
+	})
+}
+
+func (p *replicaPool) Query(ctx context.Context, query string, args ...any) (driver.Rows, error) {
+	var rows driver.Rows
+	err := p.read(ctx, func(conn clickhouse.Conn) (err error) {
+		rows, err = conn.Query(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+func (p *replicaPool) QueryRow(ctx context.Context, query string, args ...any) driver.Row {
+	var row driver.Row
+	p.read(ctx, func(conn clickhouse.Conn) error {
+		row = conn.QueryRow(ctx, query, args...)
+		return row.Err()
+	})
+	return row
+}
+
+func (p *replicaPool) PrepareBatch(ctx context.Context, query string, opts ...driver.PrepareBatchOption) (driver.Batch, error) {
+	return p.replicas[p.start()].PrepareBatch(ctx, query, opts...)
+}
+
+func (p *replicaPool) Exec(ctx context.Context, query string, args ...any) error {
+	return p.replicas[p.start()].Exec(ctx, query, args...)
+}
+
+func (p *replicaPool) AsyncInsert(ctx context.Context, query string, wait bool, args ...any) error {
+	return p.replicas[p.start()].AsyncInsert(ctx, query, wait, args...)
+}
+
+// Ping succeeds while any replica answers
+func (p *replicaPool) Ping(ctx context.Context) error {
+	return p.read(ctx, func(conn clickhouse.Conn) error { return conn.Ping(ctx) })
+}
+
+// Stats adds up the pools of all replicas
+func (p *replicaPool) Stats() driver.Stats {
+	var total driver.Stats
+	for _, conn := range p.replicas {
+		stats := conn.Stats()
+		total.MaxOpenConns += stats.MaxOpenConns
+		total.MaxIdleConns += stats.MaxIdleConns
+		total.Open += stats.Open
+		total.Idle += stats.Idle
+	}
+	return total
+}
+
+func (p *replicaPool) Close() error {
+	var errs []error
+	for _, conn := range p.replicas {
+		errs = append(errs, conn.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// isReplicaFailure reports whether err means the replica could not be reached or dropped
+// the connection, as opposed to the server rejecting or failing the query. Only the former
+// is worth retrying elsewhere: a ClickHouse exception would fail the same way on any replica.
+func isReplicaFailure(err error) bool {
+	var exception *clickhouse.Exception
+	if errors.As(err, &exception) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, clickhouse.ErrAcquireConnTimeout) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
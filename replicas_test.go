@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// stubReplica is a clickhouse.Conn whose Select returns err and counts its calls
+type stubReplica struct {
+	clickhouse.Conn
+	err   error
+	calls int
+}
+
+func (s *stubReplica) Select(ctx context.Context, dest any, query string, args ...any) error {
+	s.calls++
+	return s.err
+}
+
+func TestReplicaPoolFallsBackFromUnreachableReplica(t *testing.T) {
+	defer func(old bool) { cfg.ReplicaRetry = old }(cfg.ReplicaRetry)
+	cfg.ReplicaRetry = true
+	down := &stubReplica{err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}}
+	up := &stubReplica{}
+	pool := &replicaPool{addrs: []string{"down:9000", "up:9000"}, replicas: []clickhouse.Conn{down, up}}
+
+	for i := 0; i < 4; i++ {
+		if err := pool.Select(context.Background(), nil, "SELECT 1"); err != nil {
+			t.Fatalf("query %d: %v", i, err)
+		}
+	}
+	// Round robin starts on each replica twice; the down one fails over every time
+	if down.calls != 2 || up.calls != 4 {
+		t.Errorf("calls = down %d, up %d; want 2, 4", down.calls, up.calls)
+	}
+}
+
+func TestReplicaPoolReturnsLastErrorWhenAllReplicasFail(t *testing.T) {
+	defer func(old bool) { cfg.ReplicaRetry = old }(cfg.ReplicaRetry)
+	cfg.ReplicaRetry = true
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	first, second := &stubReplica{err: refused}, &stubReplica{err: io.EOF}
+	pool := &replicaPool{addrs: []string{"a:9000", "b:9000"}, replicas: []clickhouse.Conn{first, second}}
+
+	err := pool.Select(context.Background(), nil, "SELECT 1")
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("err = %v, want the second replica's io.EOF", err)
+	}
+	if first.calls != 1 || second.calls != 1 {
+		t.Errorf("calls = %d, %d; want each replica tried once", first.calls, second.calls)
+	}
+}
+
+func TestReplicaPoolDoesNotRetry(t *testing.T) {
+	defer func(old bool) { cfg.ReplicaRetry = old }(cfg.ReplicaRetry)
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	tests := []struct {
+		name  string
+		retry bool
+		err   error
+		ctx   func() context.Context
+	}{
+		{"query exception", true, &clickhouse.Exception{Code: 47, Message: "Missing columns"}, context.Background},
+		{"retry disabled", false, refused, context.Background},
+		{"cancelled request", true, refused, func() context.Context {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			return ctx
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.ReplicaRetry = tt.retry
+			failing, other := &stubReplica{err: tt.err}, &stubReplica{}
+			pool := &replicaPool{addrs: []string{"a:9000", "b:9000"}, replicas: []clickhouse.Conn{failing, other}}
+			if err := pool.Select(tt.ctx(), nil, "SELECT 1"); !errors.Is(err, tt.err) {
+				t.Errorf("err = %v, want %v", err, tt.err)
+			}
+			if other.calls != 0 {
+				t.Errorf("the other replica was tried %d times, want 0", other.calls)
+			}
+		})
+	}
+}
+
+func TestIsReplicaFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, true},
+		{"connection reset", fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{"broken pipe", fmt.Errorf("write: %w", syscall.EPIPE), true},
+		{"connection closed", io.EOF, true},
+		{"truncated packet", fmt.Errorf("decode: %w", io.ErrUnexpectedEOF), true},
+		{"pool exhausted", clickhouse.ErrAcquireConnTimeout, true},
+		{"server exception", &clickhouse.Exception{Code: 62, Message: "Syntax error"}, false},
+		{"wrapped exception", fmt.Errorf("query: %w", &clickhouse.Exception{Code: 241, Message: "Memory limit exceeded"}), false},
+		{"request cancelled", context.Canceled, false},
+		{"request deadline", context.DeadlineExceeded, false},
+		{"other error", errors.New("clickhouse [ScanRow]: converting UInt8 to *string is unsupported"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isReplicaFailure(tt.err); got != tt.want {
+				t.Errorf("isReplicaFailure(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
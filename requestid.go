@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// requestIDHeader carries the request ID on responses
+const requestIDHeader = "X-Request-ID"
+
+// traceparentHeader is the W3C Trace Context header, whose trace-id is used as request ID
+const traceparentHeader = "traceparent"
+
+// requestIDKey stores the request ID in the request's UserContext, for code that only
+// receives a context, such as the replica pool
+type requestIDKey struct{}
+
+// requestID tags the request with an ID for logs and responses: the first valid one among
+// the REQUEST_ID_HEADERS of the incoming request, or a new random one. It is returned in
+// X-Request-ID, available to handlers through requestIDOf and prefixed to their log lines
+// by logf. Server errors are logged with the ID once the handler has run.
+func requestID(c *fiber.Ctx) error {
+	id := ""
+	for _, header := range cfg.RequestIDHeaders {
+		if id = incomingRequestID(header, c.Get(header)); id != "" {
+			break
+		}
+	}
+	if id == "" {
+		id = newRequestID()
+	}
+	c.Locals("request_id", id)
+	c.SetUserContext(context.WithValue(c.UserContext(), requestIDKey{}, id))
+	c.Set(requestIDHeader, id)
+	err := c.Next()
+	var fiberErr *fiber.Error
+	switch {
+	case errors.As(err, &fiberErr) && fiberErr.Code < fiber.StatusInternalServerError:
+		// A client error such as an unknown route
+	case err != nil:
+		logf(c, "%s %s failed: %v", c.Method(), c.Path(), err)
+	case c.Response().StatusCode() >= fiber.StatusInternalServerError:
+		logf(c, "%s %s returned %d: %s", c.Method(), c.Path(), c.Response().StatusCode(), c.Response().Body())
+	}
+	return err
+}
+
+// logf logs like log.Printf on behalf of the request, prefixed with its ID
+func logf(c *fiber.Ctx, format string, args ...interface{}) {
+	logContextf(c.UserContext(), format, args...)
+}
+
+// logContextf logs like log.Printf, prefixed with the ID of the request ctx was derived
+// from; lines outside a request are logged as is
+func logContextf(ctx context.Context, format string, args ...interface{}) {
+	if id, _ := ctx.Value(requestIDKey{}).(string); id != "" {
+		format = "request " + id + ": " + format
+	}
+	log.Printf(format, args...)
+}
+
+// requestIDOf returns the ID requestID assigned to the request
+func requestIDOf(c *fiber.Ctx) string {
+	id, _ := c.Locals("request_id").(string)
+	return id
+}
+
+// incomingRequestID extracts a request ID from a header value, or "" when it is not
+// acceptable. IDs end up in log lines, so only a short run of safe characters is taken
+// as is; anything else is discarded rather than sanitized.
+func incomingRequestID(header, value string) string {
+	if strings.EqualFold(header, traceparentHeader) {
+		// version-traceid-parentid-flags, e.g. 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+		parts := strings.Split(value, "-")
+		if len(parts) != 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+			return ""
+		}
+		for _, part := range parts {
+			if !isLowerHex(part) {
+				return ""
+			}
+		}
+		if parts[0] == "ff" || strings.Trim(parts[1], "0") == "" {
+			return ""
+		}
+		return parts[1]
+	}
+	if len(value) == 0 || len(value) > 128 {
+		return ""
+	}
+	for _, r := range value {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("._:-", r)) {
+			return ""
+		}
+	}
+	return value
+}
+
+// isLowerHex reports whether s is made of lowercase hex digits only
+func isLowerHex(s string) bool {
+	for _, r := range s {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random 128-bit ID in hex, the same shape as a trace-id
+func newRequestID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/gofiber/fiber/v2"
+)
+
+// captureLog collects the log output of the test
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	flags := log.Flags()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(flags)
+	})
+	return &buf
+}
+
+func TestRequestIDLogsServerErrors(t *testing.T) {
+	out := captureLog(t)
+	app := fiber.New()
+	app.Use(requestID)
+	app.Get("/fail", func(c *fiber.Ctx) error {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Query execution failed"})
+	})
+	app.Get("/ok", func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	for _, path := range []string{"/fail", "/ok", "/missing"} {
+		req := httptest.NewRequest(fiber.MethodGet, path, nil)
+		req.Header.Set(requestIDHeader, "client-42")
+		if _, err := app.Test(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := "request client-42: GET /fail returned 500: {\"error\":\"Query execution failed\"}\n"
+	if out.String() != want {
+		t.Errorf("log = %q, want %q", out.String(), want)
+	}
+}
+
+func TestReplicaRetryLogsRequestID(t *testing.T) {
+	defer func(old bool) { cfg.ReplicaRetry = old }(cfg.ReplicaRetry)
+	cfg.ReplicaRetry = true
+	down := &stubReplica{err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}}
+	pool := &replicaPool{addrs: []string{"down:9000", "up:9000"}, replicas: []clickhouse.Conn{down, &stubReplica{}}}
+
+	for _, tt := range []struct {
+		ctx  context.Context
+		want string
+	}{
+		{context.WithValue(context.Background(), requestIDKey{}, "client-42"), "request client-42: replica down:9000 unreachable"},
+		{context.Background(), "replica down:9000 unreachable"},
+	} {
+		out := captureLog(t)
+		pool.next.Store(0)
+		if err := pool.Select(tt.ctx, nil, "SELECT 1"); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(out.Bytes(), []byte(tt.want)) {
+			t.Errorf("log = %q, want it to start with %q", out.String(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/gofiber/fiber/v2"
+)
+
+// queryTimeHeader carries the milliseconds the handler took, its queries included
+const queryTimeHeader = "X-Query-Time-Ms"
+
+// queryStats accumulates the progress ClickHouse reports for the queries of one request
+type queryStats struct {
+	rowsRead  atomic.Uint64
+	bytesRead atomic.Uint64
+}
+
+// trackResources attaches a progress listener to the request's context, so every query a
+// handler runs with c.UserContext() adds to the request's totals. After the handler it
+// reports them in X-Rows-Read / X-Bytes-Read, with the handler's duration in
+// X-Query-Time-Ms, and adds them to the per-consumer counters.
+//
+// Accuracy: the totals are the rows and bytes ClickHouse reports having read in its
+// progress packets, summed over the request's queries. They match system.query_log's
+// read_rows/read_bytes for completed queries, but exclude work done for cached or
+// cancelled queries. When the server sent no progress at all, rows read falls back to the
+// number of rows returned and bytes read is reported as 0.
+func trackResources(c *fiber.Ctx) error {
+	stats := &queryStats{}
+	c.SetUserContext(clickhouse.Context(c.UserContext(), clickhouse.WithProgress(func(p *clickhouse.Progress) {
+		stats.rowsRead.Add(p.Rows)
+		stats.bytesRead.Add(p.Bytes)
+	})))
+
+	start := time.Now()
+	err := c.Next()
+	c.Set(queryTimeHeader, strconv.FormatInt(time.Since(start).Milliseconds(), 10))
+
+	rows, bytes := stats.rowsRead.Load(), stats.bytesRead.Load()
+	if rows == 0 {
+		if n, ok := c.Locals("rows_returned").(int); ok {
+			rows = uint64(n)
+		}
+	}
+	c.Set("X-Rows-Read", strconv.FormatUint(rows, 10))
+	c.Set("X-Bytes-Read", strconv.FormatUint(bytes, 10))
+
+	// Labelled by configured key only: any client can send an arbitrary X-API-Key
+	consumer := knownConsumerID(c)
+	rowsReadTotal.WithLabelValues(consumer).Add(float64(rows))
+	bytesReadTotal.WithLabelValues(consumer).Add(float64(bytes))
+	return err
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestCountAndTimeHeaders(t *testing.T) {
+	assumeTableNotEmpty(t)
+	app := fiber.New()
+	rows := []LocationName{{}, {}, {}}
+	app.Get("/", trackResources, func(c *fiber.Ctx) error { return respond(c, rows) })
+	app.Get("/truncated", trackResources, func(c *fiber.Ctx) error {
+		addMeta(c, "truncated", true)
+		return respond(c, rows)
+	})
+	app.Get("/object", trackResources, func(c *fiber.Ctx) error { return respond(c, fiber.Map{}) })
+
+	for path, want := range map[string]string{"/": "3", "/truncated": "", "/object": ""} {
+		resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := resp.Header.Get(totalCountHeader); got != want {
+			t.Errorf("%s: %s = %q, want %q", path, totalCountHeader, got, want)
+		}
+		if _, err := strconv.ParseInt(resp.Header.Get(queryTimeHeader), 10, 64); err != nil {
+			t.Errorf("%s: %s = %q, want milliseconds", path, queryTimeHeader, resp.Header.Get(queryTimeHeader))
+		}
+	}
+}
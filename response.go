@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Response schema versions. Version 1 is the original bare-array format kept for
+// clients that cannot be updated; version 2 wraps data in an envelope.
+const (
+	schemaV1 = 1
+	schemaV2 = 2
+)
+
+// schemaVersionHeader carries the requested schema version and echoes the one served
+const schemaVersionHeader = "X-API-Schema-Version"
+
+// totalCountHeader carries the number of rows of a list response
+const totalCountHeader = "X-Total-Count"
+
+// v2Shaper is implemented by response data whose version 2 shape differs from version 1
+type v2Shaper interface {
+	v2() interface{}
+}
+
+// envelope is the version 2 response body
+type envelope struct {
+	SchemaVersion int         `json:"schema_version"`
+	Data          interface{} `json:"data"`
+	Meta          fiber.Map   `json:"meta"`
+}
+
+// negotiateSchema resolves the schema version from the X-API-Schema-Version header,
+// falling back to the schema_version query parameter and then DEFAULT_SCHEMA_VERSION
+func negotiateSchema(c *fiber.Ctx) error {
+	version := cfg.DefaultSchemaVersion
+	raw := c.Get(schemaVersionHeader)
+	if raw == "" {
+		raw = c.Query("schema_version")
+	}
+	if raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || (v != schemaV1 && v != schemaV2) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Unsupported schema version " + strconv.Quote(raw)})
+		}
+		version = v
+	}
+	c.Locals("schema_version", version)
+	c.Set(schemaVersionHeader, strconv.Itoa(version))
+	return c.Next()
+}
+
+// schemaVersion returns the version negotiated for the request
+func schemaVersion(c *fiber.Ctx) int {
+	if v, ok := c.Locals("schema_version").(int); ok {
+		return v
+	}
+	return cfg.DefaultSchemaVersion
+}
+
+// addMeta records response metadata, returned in the version 2 envelope
+func addMeta(c *fiber.Ctx, key string, value interface{}) {
+	meta, _ := c.Locals("meta").(fiber.Map)
+	if meta == nil {
+		meta = fiber.Map{}
+		c.Locals("meta", meta)
+	}
+	meta[key] = value
+}
+
+// addWarning records a non-fatal problem with the request. Warnings are returned in
+// the version 2 metadata and, for every version, as X-Warning headers.
+func addWarning(c *fiber.Ctx, message string) {
+	meta, _ := c.Locals("meta").(fiber.Map)
+	warnings, _ := meta["warnings"].([]string)
+	addMeta(c, "warnings", append(warnings, message))
+	c.Append("X-Warning", message)
+}
+
+// respond writes data in the negotiated schema version. Handlers build one result
+// and leave the wire format to this adapter.
+func respond(c *fiber.Ctx, data interface{}) error {
+	if v := reflect.ValueOf(data); v.Kind() == reflect.Slice {
+		c.Locals("rows_returned", v.Len())
+		// An empty result may mean nothing has been ingested yet rather than no match
+		if v.Len() == 0 {
+			if done, err := respondEmptyTable(c); done {
+				return err
+			}
+		}
+		// A truncated result only holds part of the matching rows, whose total is unknown
+		if meta, _ := c.Locals("meta").(fiber.Map); meta["truncated"] != true {
+			c.Set(totalCountHeader, strconv.Itoa(v.Len()))
+		}
+		if v.Type().Elem().Kind() == reflect.Struct && wantsHTML(c) {
+			return respondHTML(c, v)
+		}
+	}
+	if schemaVersion(c) == schemaV1 {
+		return sendJSON(c, data)
+	}
+
+	if shaper, ok := data.(v2Shaper); ok {
+		data = shaper.v2()
+	}
+	// Version 2 never returns null for an empty result
+	if v := reflect.ValueOf(data); v.Kind() == reflect.Slice && v.IsNil() {
+		data = reflect.MakeSlice(v.Type(), 0, 0).Interface()
+	}
+	meta, _ := c.Locals("meta").(fiber.Map)
+	if meta == nil {
+		meta = fiber.Map{}
+	}
+	if v := reflect.ValueOf(data); v.Kind() == reflect.Slice {
+		meta["count"] = v.Len()
+	}
+	return sendJSON(c, envelope{SchemaVersion: schemaV2, Data: data, Meta: meta})
+}
+
+// sendJSON writes v as compact JSON, or indented when the request asks for ?pretty=true.
+// With ?int64_as_string=true (default INT64_AS_STRING) cumulative counts are sent as strings,
+// and with ?metric_aliases=true (default METRIC_ALIASES_IN_RESPONSES) metrics are named by
+// their METRIC_ALIASES alias.
+func sendJSON(c *fiber.Ctx, v interface{}) error {
+	rewrite := jsonRewrite{quoteCumulative: c.QueryBool("int64_as_string", cfg.Int64AsString)}
+	if responseAliases(c) {
+		aliases := columnAliases()
+		rewrite.keys, rewrite.values, rewrite.valueMembers = aliases, aliases, map[string]bool{"metric": true, "columns": true}
+	}
+	if !c.QueryBool("pretty") && !rewrite.changes() {
+		return c.JSON(v)
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if rewrite.changes() {
+		if body, err = rewrite.apply(body); err != nil {
+			return err
+		}
+	}
+	if c.QueryBool("pretty") {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, body, "", "  "); err != nil {
+			return err
+		}
+		body = append(indented.Bytes(), '\n')
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(body)
+}
+
+// jsonRewrite edits encoded JSON token by token, keeping key order and every value it is
+// not asked to change
+type jsonRewrite struct {
+	// quoteCumulative turns every integer under a cumulative_* key into a string. Running
+	// totals are the counts that can outgrow the 2^53 integers JavaScript numbers represent
+	// exactly.
+	quoteCumulative bool
+	keys            map[string]string // object keys renamed anywhere
+	values          map[string]string // names renamed inside valueMembers
+	valueMembers    map[string]bool   // members whose string values, string elements and object keys are renamed via values
+}
+
+// changes reports whether the rewrite can alter anything
+func (r jsonRewrite) changes() bool {
+	return r.quoteCumulative || len(r.keys) > 0 || len(r.values) > 0
+}
+
+// apply rewrites body
+func (r jsonRewrite) apply(body []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var out bytes.Buffer
+	if err := r.value(dec, &out, false, false); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// value copies the next JSON value from dec to out, quoting it when it is an integer and
+// quote is set, and renaming names via values when inside a valueMembers member
+func (r jsonRewrite) value(dec *json.Decoder, out *bytes.Buffer, quote, inValues bool) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch t := token.(type) {
+	case json.Delim:
+		object := t == '{'
+		out.WriteRune(rune(t))
+		for i := 0; dec.More(); i++ {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			quoteMember, memberValues := false, inValues
+			if object {
+				token, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				key := token.(string)
+				quoteMember = r.quoteCumulative && strings.HasPrefix(key, "cumulative_")
+				memberValues = r.valueMembers[key]
+				renamed := r.rename(r.keys, key)
+				if inValues {
+					renamed = r.rename(r.values, key)
+				}
+				name, _ := json.Marshal(renamed)
+				out.Write(name)
+				out.WriteByte(':')
+			}
+			if err := r.value(dec, out, quoteMember, memberValues); err != nil {
+				return err
+			}
+		}
+		end, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		out.WriteRune(rune(end.(json.Delim)))
+	case json.Number:
+		if _, err := t.Int64(); quote && err == nil {
+			out.WriteString(`"` + t.String() + `"`)
+		} else {
+			out.WriteString(t.String())
+		}
+	case string:
+		if inValues {
+			t = r.rename(r.values, t)
+		}
+		value, _ := json.Marshal(t)
+		out.Write(value)
+	default:
+		value, _ := json.Marshal(t)
+		out.Write(value)
+	}
+	return nil
+}
+
+// rename returns names[name], or name when it has no entry
+func (r jsonRewrite) rename(names map[string]string, name string) string {
+	if renamed, ok := names[name]; ok {
+		return renamed
+	}
+	return name
+}
+
+// timeSeriesRows is the /api/timeseries result
+type timeSeriesRows []TimeSeriesData
+
+// TimeSeriesDataV2 is the version 2 row: every metric is present (null when not
+// selected) and counts are 64-bit
+type TimeSeriesDataV2 struct {
+	Date                Date       `json:"date"`
+	LocationKey         string     `json:"location_key"`
+	NewConfirmed        *int64     `json:"new_confirmed"`
+	NewDeceased         *int64     `json:"new_deceased"`
+	NewRecovered        *int64     `json:"new_recovered"`
+	NewTested           *int64     `json:"new_tested"`
+	CumulativeConfirmed *int64     `json:"cumulative_confirmed"`
+	CumulativeDeceased  *int64     `json:"cumulative_deceased"`
+	CumulativeRecovered *int64     `json:"cumulative_recovered"`
+	CumulativeTested    *int64     `json:"cumulative_tested"`
+	Positivity          *float64   `json:"positivity,omitempty"`
+	UpdatedAt           *time.Time `json:"updated_at,omitempty"`
+	DaysSinceFirstCase  **int32    `json:"days_since_first_case,omitempty"`
+	DecreasingColumns   []string   `json:"decreasing_columns,omitempty"`
+	NewConfirmedSum     **int64    `json:"new_confirmed_sum,omitempty"`
+	NewDeceasedSum      **int64    `json:"new_deceased_sum,omitempty"`
+	NewRecoveredSum     **int64    `json:"new_recovered_sum,omitempty"`
+	NewTestedSum        **int64    `json:"new_tested_sum,omitempty"`
+}
+
+func (rows timeSeriesRows) v2() interface{} {
+	out := make([]TimeSeriesDataV2, len(rows))
+	for i, ts := range rows {
+		out[i] = TimeSeriesDataV2{
+			Date:                ts.Date,
+			LocationKey:         ts.LocationKey,
+			NewConfirmed:        widen(ts.NewConfirmed),
+			NewDeceased:         widen(ts.NewDeceased),
+			NewRecovered:        widen(ts.NewRecovered),
+			NewTested:           widen(ts.NewTested),
+			CumulativeConfirmed: widen(ts.CumulativeConfirmed),
+			CumulativeDeceased:  widen(ts.CumulativeDeceased),
+			CumulativeRecovered: widen(ts.CumulativeRecovered),
+			CumulativeTested:    widen(ts.CumulativeTested),
+			Positivity:          ts.Positivity,
+			UpdatedAt:           ts.UpdatedAt,
+			DaysSinceFirstCase:  ts.DaysSinceFirstCase,
+			DecreasingColumns:   ts.DecreasingColumns,
+			NewConfirmedSum:     ts.NewConfirmedSum,
+			NewDeceasedSum:      ts.NewDeceasedSum,
+			NewRecoveredSum:     ts.NewRecoveredSum,
+			NewTestedSum:        ts.NewTestedSum,
+		}
+	}
+	return out
+}
+
+// widen converts an optional 32-bit metric to 64 bits
+func widen(v *int32) *int64 {
+	if v == nil {
+		return nil
+	}
+	w := int64(*v)
+	return &w
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// TestMain runs the tests with the default configuration
+func TestMain(m *testing.M) {
+	cfg = loadConfig()
+	os.Exit(m.Run())
+}
+
+// checkGolden compares got with testdata/name, or rewrites the file with -update
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading golden file (run go test -update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s\ngot:  %s\nwant: %s", path, got, want)
+	}
+}
+
+// assumeTableNotEmpty stops empty results from checking covid19 for rows
+func assumeTableNotEmpty(t *testing.T) {
+	t.Helper()
+	emptyTable.Lock()
+	emptyTable.checked, emptyTable.empty = time.Now(), false
+	emptyTable.Unlock()
+	t.Cleanup(func() {
+		emptyTable.Lock()
+		emptyTable.checked = time.Time{}
+		emptyTable.Unlock()
+	})
+}
+
+// respondTest serves rows through negotiateSchema and respond and returns the body sent
+// for the given X-API-Schema-Version
+func respondTest(t *testing.T, version string, rows func(format dateFormat) interface{}) []byte {
+	t.Helper()
+	app := fiber.New()
+	app.Get("/", negotiateSchema, func(c *fiber.Ctx) error {
+		format, err := resolveDateFormat(c, "")
+		if err != nil {
+			return err
+		}
+		return respond(c, rows(format))
+	})
+	req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+	req.Header.Set(schemaVersionHeader, version)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+// timeSeriesFixture has a fully selected row and one with only some metrics selected
+func timeSeriesFixture(format dateFormat) interface{} {
+	confirmed, deceased, cumulative := int32(4388), int32(-2), int32(2147483647)
+	positivity := 0.0412
+	return timeSeriesRows{
+		{
+			Date:                Date{Time: time.Date(2021, 3, 5, 0, 0, 0, 0, time.UTC), format: format},
+			LocationKey:         "US_CA",
+			NewConfirmed:        &confirmed,
+			NewDeceased:         &deceased,
+			CumulativeConfirmed: &cumulative,
+			Positivity:          &positivity,
+		},
+		{
+			Date:         Date{Time: time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC), format: format},
+			LocationKey:  "FR",
+			NewConfirmed: &confirmed,
+		},
+	}
+}
+
+func TestRespondTimeSeriesGolden(t *testing.T) {
+	assumeTableNotEmpty(t)
+	tests := []struct {
+		golden  string
+		version string
+		rows    func(dateFormat) interface{}
+	}{
+		{"timeseries_v1.golden", "1", timeSeriesFixture},
+		{"timeseries_v2.golden", "2", timeSeriesFixture},
+		{"timeseries_v1_empty.golden", "1", func(dateFormat) interface{} { return timeSeriesRows(nil) }},
+		{"timeseries_v2_empty.golden", "2", func(dateFormat) interface{} { return timeSeriesRows(nil) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			checkGolden(t, tt.golden, respondTest(t, tt.version, tt.rows))
+		})
+	}
+}
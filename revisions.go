@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RevisionsRequest compares the data as known at two as-of dates
+type RevisionsRequest struct {
+	FilterRequest
+	From string `json:"from"` // Required: earlier as-of date
+	To   string `json:"to"`   // Required: later as-of date
+}
+
+// MetricChange is one metric's value at both snapshots
+type MetricChange struct {
+	From  *int32 `json:"from"` // null when the row did not exist yet
+	To    int32  `json:"to"`
+	Delta int64  `json:"delta"`
+}
+
+// RevisionData lists the metrics of a (location_key, date) row that differ between the snapshots
+type RevisionData struct {
+	Date        Date                    `json:"date"`
+	LocationKey string                  `json:"location_key"`
+	Status      string                  `json:"status"` // "added" or "revised"
+	Changes     map[string]MetricChange `json:"changes"`
+}
+
+// validate checks both snapshot dates and the optional date range
+func (r RevisionsRequest) validate() error {
+	if _, _, err := parseDateRange("from", r.From, "to", r.To); err != nil {
+		return err
+	}
+	if r.From == r.To {
+		return fmt.Errorf("from and to must differ")
+	}
+	if r.StartDate != "" || r.EndDate != "" {
+		if _, _, err := parseDateRange("start_date", r.StartDate, "end_date", r.EndDate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getRevisions handles POST /api/revisions. For every (location_key, date) the latest
+// revision ingested on or before each snapshot date is compared; rows first ingested
+// after from are reported as added, rows whose selected metrics changed as revised.
+// Without a versioned table there is nothing to compare and an empty list is returned.
+func getRevisions(c *fiber.Ctx) error {
+	var req RevisionsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid filter parameters"})
+	}
+	if err := req.validate(); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	columns, err := resolveFields(req.Fields)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	keys, err := req.locationKeys()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	format, err := resolveDateFormat(c, req.DateFormat)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !tableHasColumn(cfg.UpdatedAtColumn) {
+		addWarning(c, "revisions unavailable: the covid19 table is not versioned")
+		return respond(c, []RevisionData{})
+	}
+	recordUsageFilter(c, keys, req.StartDate, req.EndDate)
+	clampDateRange(c, req.StartDate, req.EndDate)
+
+	from, _ := parseDate(req.From)
+	to, _ := parseDate(req.To)
+	args := []interface{}{from.Format(time.DateOnly), to.Format(time.DateOnly)}
+	revised := quoteIdentifier(cfg.UpdatedAtColumn)
+	conditions := append([]string{"toDate(" + revised + ") <= to_date"}, futureConditions(c)...)
+	if len(keys) > 0 {
+		condition, arg := locationCondition(keys)
+		conditions = append(conditions, condition)
+		args = append(args, arg)
+	}
+	if req.StartDate != "" {
+		conditions = append(conditions, "date BETWEEN ? AND ?")
+		args = append(args, req.StartDate, req.EndDate)
+	}
+
+	selects := "countIf(toDate(" + revised + ") <= from_date) AS from_rows"
+	having := "from_rows = 0"
+	for _, column := range columns {
+		selects += fmt.Sprintf(",\n\t\t   argMaxIf(%s, %s, toDate(%s) <= from_date) AS %s_from", column, revised, revised, column)
+		selects += fmt.Sprintf(",\n\t\t   argMax(%s, %s) AS %s_to", column, revised, column)
+		having += fmt.Sprintf(" OR %s_from != %s_to", column, column)
+	}
+	query := `
+	WITH toDate(?) AS from_date, toDate(?) AS to_date
+	SELECT location_key, date,
+		   ` + selects + `
+	FROM covid19
+	WHERE ` + join(conditions, " AND ") + `
+	GROUP BY location_key, date
+	HAVING ` + having + `
+	ORDER BY location_key, date`
+
+	rows, err := db.Query(c.UserContext(), query, args...)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Query execution failed: " + err.Error()})
+	}
+	defer rows.Close()
+
+	data := []RevisionData{}
+	for rows.Next() {
+		r := RevisionData{Date: Date{format: format}, Changes: map[string]MetricChange{}}
+		var fromRows uint64
+		values := make([]int32, 2*len(columns))
+		dest := []interface{}{&r.LocationKey, &r.Date.Time, &fromRows}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Row scan failed: " + err.Error()})
+		}
+		r.Status = "revised"
+		if fromRows == 0 {
+			r.Status = "added"
+		}
+		for i, column := range columns {
+			before, after := values[2*i], values[2*i+1]
+			if fromRows == 0 {
+				r.Changes[column] = MetricChange{To: after, Delta: int64(after)}
+			} else if before != after {
+				r.Changes[column] = MetricChange{From: &before, To: after, Delta: int64(after) - int64(before)}
+			}
+		}
+		data = append(data, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading rows"})
+	}
+
+	return respond(c, data)
+}
@@ -0,0 +1,21 @@
+package main
+
+import "math"
+
+// round limits a computed value to FLOAT_PRECISION decimal places. Raw integer
+// columns are never passed through it.
+func round(v float64) float64 {
+	if cfg.FloatPrecision < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+		return v
+	}
+	scale := math.Pow(10, float64(cfg.FloatPrecision))
+	return math.Round(v*scale) / scale
+}
+
+// roundPtr rounds an optional computed value in place and returns it
+func roundPtr(v *float64) *float64 {
+	if v != nil {
+		*v = round(*v)
+	}
+	return v
+}
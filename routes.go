@@ -0,0 +1,75 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RouteInfo describes one registered route for /api/routes
+type RouteInfo struct {
+	Method      string `json:"method"`
+	Path        string `json:"path"`
+	Description string `json:"description"`
+}
+
+// routeRegistry lists every route registered through a routeGroup, in registration order
+var routeRegistry []RouteInfo
+
+// routeGroup registers routes on a fiber router and records them with their description
+type routeGroup struct {
+	router fiber.Router
+	prefix string
+}
+
+// newRouteGroup creates a fiber group at prefix with the given middleware
+func newRouteGroup(app *fiber.App, prefix string, middleware ...fiber.Handler) routeGroup {
+	return routeGroup{router: app.Group(prefix, middleware...), prefix: prefix}
+}
+
+// add registers a route and records it in the registry
+func (g routeGroup) add(method, path, description string, handlers ...fiber.Handler) {
+	g.router.Add(method, path, handlers...)
+	routeRegistry = append(routeRegistry, RouteInfo{Method: method, Path: g.prefix + path, Description: description})
+}
+
+// getRoutes handles GET /api/routes
+func getRoutes(c *fiber.Ctx) error {
+	return respond(c, routeRegistry)
+}
+
+// routeDurations applies the "path=duration" entries of the env list name to a copy of defaults
+func routeDurations(name string, defaults map[string]time.Duration, overrides []string) map[string]time.Duration {
+	policy := make(map[string]time.Duration, len(defaults))
+	for path, d := range defaults {
+		policy[path] = d
+	}
+	for _, entry := range overrides {
+		path, value, ok := strings.Cut(entry, "=")
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if !ok || err != nil {
+			log.Printf("ignoring invalid %s entry %q", name, entry)
+			continue
+		}
+		policy[strings.TrimSpace(path)] = d
+	}
+	return policy
+}
+
+// routeDuration looks up path in policy, falling back to the longest matching "prefix/*" entry
+func routeDuration(policy map[string]time.Duration, path string) (time.Duration, bool) {
+	if d, ok := policy[path]; ok {
+		return d, true
+	}
+	best, found := "", false
+	var d time.Duration
+	for pattern, value := range policy {
+		prefix, ok := strings.CutSuffix(pattern, "*")
+		if ok && strings.HasPrefix(path, prefix) && len(prefix) > len(best) {
+			best, d, found = prefix, value, true
+		}
+	}
+	return d, found
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Responses for results longer than MAX_ROWS, see ROW_LIMIT_BEHAVIOR
+const (
+	rowLimitTruncate = "truncate" // 200 with the first MAX_ROWS rows, X-Truncated and a warning
+	rowLimitReject   = "reject"   // 400 asking the client to narrow the query
+)
+
+// truncatedHeader marks responses cut short by MAX_ROWS
+const truncatedHeader = "X-Truncated"
+
+// normalizeRowLimitBehavior validates ROW_LIMIT_BEHAVIOR, defaulting to truncate
+func normalizeRowLimitBehavior(behavior string) string {
+	if behavior == rowLimitReject {
+		return behavior
+	}
+	return rowLimitTruncate
+}
+
+// rowLimit returns the row limit of the request's schema version and the setting it comes
+// from. Version 1 responses were never limited, so they stay whole unless MAX_ROWS_V1 is set.
+func rowLimit(c *fiber.Ctx) (int, string) {
+	if schemaVersion(c) == schemaV1 {
+		return cfg.MaxRowsV1, "MAX_ROWS_V1"
+	}
+	return cfg.MaxRows, "MAX_ROWS"
+}
+
+// rowLimitClause fetches one row more than the row limit, so an overflow can be told apart
+// from a result of exactly that many rows; empty when the limit is disabled
+func rowLimitClause(c *fiber.Ctx) string {
+	limit, _ := rowLimit(c)
+	if limit <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("\n\tLIMIT %d", limit+1)
+}
+
+// applyRowLimit returns how many of the returned rows to send. Within the row limit that is
+// all of them; beyond it, the first rows up to the limit with X-Truncated, meta.truncated and
+// a warning, or false when ROW_LIMIT_BEHAVIOR=reject and the request must be refused instead.
+func applyRowLimit(c *fiber.Ctx, returned int) (int, bool) {
+	limit, setting := rowLimit(c)
+	if limit <= 0 || returned <= limit {
+		return returned, true
+	}
+	if cfg.RowLimitBehavior == rowLimitReject {
+		return 0, false
+	}
+	c.Set(truncatedHeader, "true")
+	addMeta(c, "truncated", true)
+	addWarning(c, fmt.Sprintf("result truncated to %s (%d rows); narrow the filters for the rest", setting, limit))
+	return limit, true
+}
+
+// rowLimitError is the 400 body of a request rejected by the row limit
+func rowLimitError(c *fiber.Ctx) fiber.Map {
+	limit, setting := rowLimit(c)
+	return fiber.Map{"error": fmt.Sprintf("result exceeds %s (%d rows); narrow location_keys, the date range or top_k", setting, limit)}
+}
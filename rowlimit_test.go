@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestApplyRowLimit(t *testing.T) {
+	defer func(rows int, behavior string) { cfg.MaxRows, cfg.RowLimitBehavior = rows, behavior }(cfg.MaxRows, cfg.RowLimitBehavior)
+	cfg.MaxRows = 3
+	tests := []struct {
+		behavior  string
+		returned  int
+		keep      int
+		ok        bool
+		truncated bool
+	}{
+		{rowLimitTruncate, 2, 2, true, false},
+		{rowLimitTruncate, 3, 3, true, false},
+		{rowLimitTruncate, 4, 3, true, true},
+		{rowLimitReject, 2, 2, true, false},
+		{rowLimitReject, 3, 3, true, false},
+		{rowLimitReject, 4, 0, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %d rows", tt.behavior, tt.returned), func(t *testing.T) {
+			cfg.RowLimitBehavior = tt.behavior
+			var keep int
+			var ok bool
+			var meta fiber.Map
+			app := fiber.New()
+			app.Get("/", func(c *fiber.Ctx) error {
+				c.Locals("schema_version", schemaV2)
+				keep, ok = applyRowLimit(c, tt.returned)
+				meta, _ = c.Locals("meta").(fiber.Map)
+				return nil
+			})
+			resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if keep != tt.keep || ok != tt.ok {
+				t.Errorf("applyRowLimit(%d) = %d, %v; want %d, %v", tt.returned, keep, ok, tt.keep, tt.ok)
+			}
+			header := resp.Header.Get(truncatedHeader) == "true"
+			if header != tt.truncated || (meta["truncated"] == true) != tt.truncated || (resp.Header.Get("X-Warning") != "") != tt.truncated {
+				t.Errorf("%s = %v, meta %v, X-Warning %q; want truncated %v", truncatedHeader, header, meta, resp.Header.Get("X-Warning"), tt.truncated)
+			}
+		})
+	}
+}
+
+func TestRowLimitClause(t *testing.T) {
+	defer func(rows, v1 int) { cfg.MaxRows, cfg.MaxRowsV1 = rows, v1 }(cfg.MaxRows, cfg.MaxRowsV1)
+	tests := []struct {
+		version, rows, v1 int
+		want              string
+	}{
+		{schemaV2, 0, 0, ""},
+		{schemaV2, -1, 0, ""},
+		{schemaV2, 3, 0, "\n\tLIMIT 4"},
+		{schemaV1, 3, 0, ""},
+		{schemaV1, 3, 5, "\n\tLIMIT 6"},
+		{schemaV2, 3, 5, "\n\tLIMIT 4"},
+	}
+	for _, tt := range tests {
+		cfg.MaxRows, cfg.MaxRowsV1 = tt.rows, tt.v1
+		var got string
+		app := fiber.New()
+		app.Get("/", func(c *fiber.Ctx) error {
+			c.Locals("schema_version", tt.version)
+			got = rowLimitClause(c)
+			return nil
+		})
+		if _, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil)); err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("rowLimitClause() for v%d with MAX_ROWS=%d, MAX_ROWS_V1=%d = %q, want %q", tt.version, tt.rows, tt.v1, got, tt.want)
+		}
+	}
+}
+
+// TestTimeSeriesRowLimitGolden locks the output of a result one row over MAX_ROWS: version 1
+// stays whole by default, version 2 and version 1 with MAX_ROWS_V1 are truncated
+func TestTimeSeriesRowLimitGolden(t *testing.T) {
+	defer func(rows, v1 int, behavior string) {
+		cfg.MaxRows, cfg.MaxRowsV1, cfg.RowLimitBehavior = rows, v1, behavior
+	}(cfg.MaxRows, cfg.MaxRowsV1, cfg.RowLimitBehavior)
+	cfg.RowLimitBehavior = rowLimitTruncate
+	assumeTableNotEmpty(t)
+	tests := []struct {
+		golden       string
+		version      string
+		rows, v1     int
+		wantLimit    string
+		wantTruncate bool
+	}{
+		{"timeseries_v1_row_limit.golden", "1", 3, 0, "", false},
+		{"timeseries_v1_max_rows_v1.golden", "1", 10, 3, "\tLIMIT 4", true},
+		{"timeseries_v2_row_limit.golden", "2", 3, 0, "\tLIMIT 4", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			cfg.MaxRows, cfg.MaxRowsV1 = tt.rows, tt.v1
+			stub := useStubConn(t, func(query string, args ...any) driver.Row { return stubRow{err: errors.New("not stubbed")} })
+			stub.query = func(query string, args ...any) [][]any {
+				var rows [][]any
+				for day := 1; day <= 4; day++ {
+					confirmed := int32(day * 100)
+					rows = append(rows, []any{"US", time.Date(2021, 3, day, 0, 0, 0, 0, time.UTC), &confirmed})
+				}
+				return rows
+			}
+			app := fiber.New()
+			app.Post("/api/timeseries", negotiateSchema, getTimeSeries)
+			req := httptest.NewRequest(fiber.MethodPost, "/api/timeseries", strings.NewReader(`{"location_key": "US", "fields": ["new_confirmed"]}`))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			req.Header.Set(schemaVersionHeader, tt.version)
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != fiber.StatusOK {
+				t.Fatalf("status %d: %s", resp.StatusCode, body)
+			}
+			if truncated := resp.Header.Get(truncatedHeader) == "true"; truncated != tt.wantTruncate {
+				t.Errorf("%s = %v, want %v", truncatedHeader, truncated, tt.wantTruncate)
+			}
+			read := stub.queries[len(stub.queries)-1]
+			if got := read[strings.LastIndex(read, "\n")+1:]; strings.HasPrefix(got, "\tLIMIT") != (tt.wantLimit != "") || !strings.HasSuffix(got, tt.wantLimit) {
+				t.Errorf("query ends with %q, want the row limit %q", got, tt.wantLimit)
+			}
+			checkGolden(t, tt.golden, body)
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// tableColumns caches the column names of the covid19 table, read once at startup
+var (
+	tableColumnsMu sync.RWMutex
+	tableColumns   = map[string]bool{}
+)
+
+// loadTableSchema reads the covid19 column list so optional features can detect
+// whether the columns they rely on exist
+func loadTableSchema(ctx context.Context) error {
+	rows, err := db.Query(ctx, "SELECT name FROM system.columns WHERE database = currentDatabase() AND table = 'covid19'")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		columns[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tableColumnsMu.Lock()
+	tableColumns = columns
+	tableColumnsMu.Unlock()
+	return nil
+}
+
+// tableHasColumn reports whether the covid19 table has the named column
+func tableHasColumn(name string) bool {
+	tableColumnsMu.RLock()
+	defer tableColumnsMu.RUnlock()
+	return tableColumns[name]
+}
+
+// quoteIdentifier quotes a configured column name for use in SQL
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
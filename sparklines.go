@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SparklineRequest selects the locations and the recent trend to summarise
+type SparklineRequest struct {
+	FilterRequest
+	Metric string `json:"metric"` // Optional: new_* column the trend is drawn from, default new_confirmed
+	Days   int    `json:"days"`   // Optional: latest reported days covered by the trend, default 30
+	Points int    `json:"points"` // Optional: values the trend is downsampled to, default 30
+}
+
+// SparklineData is a location's latest cumulative totals with its encoded recent trend
+type SparklineData struct {
+	LocationKey         string  `json:"location_key"`
+	Date                Date    `json:"date"` // latest reported day
+	CumulativeConfirmed *int32  `json:"cumulative_confirmed"`
+	CumulativeDeceased  *int32  `json:"cumulative_deceased"`
+	CumulativeRecovered *int32  `json:"cumulative_recovered"`
+	CumulativeTested    *int32  `json:"cumulative_tested"`
+	Sparkline           []int64 `json:"sparkline"` // oldest first, see downsample
+}
+
+// validate checks the metric and the trend's shape
+func (r SparklineRequest) validate() error {
+	if !isMetricColumn(r.Metric) || !strings.HasPrefix(r.Metric, "new_") {
+		return fmt.Errorf("metric must be one of the new_* columns, got %q", r.Metric)
+	}
+	if r.Days < 1 || r.Days > 365 {
+		return fmt.Errorf("days must be between 1 and 365")
+	}
+	if r.Points < 1 || r.Points > r.Days {
+		return fmt.Errorf("points must be between 1 and days (%d)", r.Days)
+	}
+	return nil
+}
+
+// getSparklines handles POST /api/sparklines: one row per requested location with its
+// latest cumulative totals and the metric over its last days reported days, downsampled
+// to points values for inline charts.
+func getSparklines(c *fiber.Ctx) error {
+	req := SparklineRequest{Metric: "new_confirmed", Days: 30, Points: 30}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid filter parameters"})
+	}
+	if err := req.validate(); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	keys, err := req.locationKeys()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(keys) == 0 || len(keys) > cfg.MaxSparklineLocations {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("sparklines need between 1 and %d location keys, got %d", cfg.MaxSparklineLocations, len(keys)),
+		})
+	}
+	format, err := resolveDateFormat(c, req.DateFormat)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	reads, readArgs, err := req.readConditions(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	recordUsageFilter(c, keys, "", "")
+
+	condition, arg := locationCondition(keys)
+	conditions := append([]string{condition}, reads...)
+	args := append([]interface{}{arg}, readArgs...)
+	query := `
+	SELECT location_key, date, cumulative_confirmed, cumulative_deceased, cumulative_recovered, cumulative_tested, ` + req.Metric + `
+	FROM ` + readSource(conditions, req.dedupe()) + `
+	ORDER BY location_key, date DESC
+	LIMIT ? BY location_key`
+	args = append(args, req.Days)
+
+	rows, err := db.Query(c.UserContext(), query, args...)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Query execution failed: " + err.Error()})
+	}
+	defer rows.Close()
+
+	// Rows arrive latest first, so each location's first row holds its totals
+	data := []SparklineData{}
+	var trend []*int32
+	finish := func() {
+		if len(data) > 0 {
+			data[len(data)-1].Sparkline = downsample(trend, req.Points)
+		}
+	}
+	for rows.Next() {
+		s := SparklineData{Date: Date{format: format}}
+		var value *int32
+		if err := rows.Scan(&s.LocationKey, &s.Date.Time, &s.CumulativeConfirmed, &s.CumulativeDeceased, &s.CumulativeRecovered, &s.CumulativeTested, &value); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Row scan failed: " + err.Error()})
+		}
+		if len(data) == 0 || data[len(data)-1].LocationKey != s.LocationKey {
+			finish()
+			data = append(data, s)
+			trend = trend[:0]
+		}
+		trend = append(trend, value)
+	}
+	finish()
+
+	if err := rows.Err(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading rows"})
+	}
+
+	return respond(c, data)
+}
+
+// downsample turns a latest-first series into at most points values, oldest first. The
+// days are split into points consecutive buckets of (as near as possible) equal length and
+// each value is the bucket's mean over its reported days, rounded; a bucket without any
+// reported value is 0.
+func downsample(latestFirst []*int32, points int) []int64 {
+	n := len(latestFirst)
+	if points > n {
+		points = n
+	}
+	out := make([]int64, points)
+	for i := range out {
+		from, to := i*n/points, (i+1)*n/points
+		sum, count := 0.0, 0
+		for j := from; j < to; j++ {
+			if v := latestFirst[n-1-j]; v != nil {
+				sum += float64(*v)
+				count++
+			}
+		}
+		if count > 0 {
+			out[i] = int64(math.Round(sum / float64(count)))
+		}
+	}
+	return out
+}
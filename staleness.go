@@ -0,0 +1,151 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Reporting cadences locations are expected to follow, set by STALENESS_CADENCE
+const (
+	cadenceDaily    = "daily"    // a report for every day
+	cadenceWeekdays = "weekdays" // reports for Monday to Friday only
+	cadenceWeekly   = "weekly"   // one report every 7 days
+)
+
+// StaleLocation is a location whose next expected report is overdue
+type StaleLocation struct {
+	LocationKey string `json:"location_key"`
+	LatestDate  Date   `json:"latest_date"`
+	ExpectedBy  Date   `json:"expected_by"`
+	OverdueDays int    `json:"overdue_days"`
+}
+
+// nextExpectedReport returns the first date after latest for which the cadence
+// expects a report, skipping STALENESS_HOLIDAYS
+func nextExpectedReport(latest time.Time) time.Time {
+	holidays := map[string]bool{}
+	for _, day := range cfg.StalenessHolidays {
+		holidays[day] = true
+	}
+	step := 1
+	if cfg.StalenessCadence == cadenceWeekly {
+		step = 7
+	}
+	next := latest.AddDate(0, 0, step)
+	for {
+		weekend := next.Weekday() == time.Saturday || next.Weekday() == time.Sunday
+		if !holidays[next.Format(time.DateOnly)] && !(cfg.StalenessCadence == cadenceWeekdays && weekend) {
+			return next
+		}
+		next = next.AddDate(0, 0, 1)
+	}
+}
+
+// overdueDays returns how many days past its grace period the report following
+// latest is on today; zero or less means the location is not stale
+func overdueDays(latest, today time.Time) (time.Time, int) {
+	expected := nextExpectedReport(latest)
+	deadline := expected.AddDate(0, 0, cfg.StalenessGraceDays)
+	return expected, int(today.Sub(deadline).Hours() / 24)
+}
+
+// latestDates returns the most recent date of every location
+func latestDates(c *fiber.Ctx) (map[string]time.Time, error) {
+	rows, err := db.Query(c.UserContext(), `SELECT location_key, max(date) FROM covid19 WHERE date <= today() GROUP BY location_key`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	latest := map[string]time.Time{}
+	for rows.Next() {
+		var key string
+		var date time.Time
+		if err := rows.Scan(&key, &date); err != nil {
+			return nil, err
+		}
+		latest[key] = date
+	}
+	return latest, rows.Err()
+}
+
+// today returns the current UTC date
+func today() time.Time {
+	return time.Now().UTC().Truncate(24 * time.Hour)
+}
+
+// getStaleLocations handles GET /api/stale-locations: locations whose next expected
+// report (per STALENESS_CADENCE) has not arrived within STALENESS_GRACE_DAYS
+func getStaleLocations(c *fiber.Ctx) error {
+	format, err := resolveDateFormat(c, c.Query("date_format"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	latest, err := latestDates(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Query execution failed: " + err.Error()})
+	}
+
+	now := today()
+	stale := []StaleLocation{}
+	for key, date := range latest {
+		expected, overdue := overdueDays(date, now)
+		if overdue > 0 {
+			stale = append(stale, StaleLocation{
+				LocationKey: key,
+				LatestDate:  Date{Time: date, format: format},
+				ExpectedBy:  Date{Time: expected, format: format},
+				OverdueDays: overdue,
+			})
+		}
+	}
+	// Most overdue first
+	sort.Slice(stale, func(i, j int) bool {
+		if stale[i].OverdueDays != stale[j].OverdueDays {
+			return stale[i].OverdueDays > stale[j].OverdueDays
+		}
+		return stale[i].LocationKey < stale[j].LocationKey
+	})
+	return respond(c, stale)
+}
+
+// getSLA handles GET /api/sla, summarizing how many locations meet the reporting cadence
+func getSLA(c *fiber.Ctx) error {
+	latest, err := latestDates(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Query execution failed: " + err.Error()})
+	}
+
+	now := today()
+	stale := 0
+	for _, date := range latest {
+		if _, overdue := overdueDays(date, now); overdue > 0 {
+			stale++
+		}
+	}
+	var freshPercent *float64
+	if len(latest) > 0 {
+		percent := round(float64(len(latest)-stale) / float64(len(latest)) * 100)
+		freshPercent = &percent
+	}
+	return respond(c, fiber.Map{
+		"cadence":         cfg.StalenessCadence,
+		"grace_days":      cfg.StalenessGraceDays,
+		"total_locations": len(latest),
+		"fresh":           len(latest) - stale,
+		"stale":           stale,
+		"fresh_percent":   freshPercent,
+	})
+}
+
+// normalizeCadence validates STALENESS_CADENCE, defaulting to daily
+func normalizeCadence(cadence string) string {
+	switch cadence {
+	case cadenceWeekdays, cadenceWeekly:
+		return cadence
+	}
+	return cadenceDaily
+}
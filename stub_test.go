@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// stubConn answers QueryRow from a function of the query; the other methods are not
+// implemented and panic if used
+type stubConn struct {
+	clickhouse.Conn
+	queryRow func(query string, args ...any) driver.Row
+	query    func(query string, args ...any) [][]any // rows answering Query; nil refuses it
+	queries  []string
+	writes   bool    // accept batches instead of refusing them
+	appended [][]any // rows sent in accepted batches
+}
+
+func (s *stubConn) QueryRow(ctx context.Context, query string, args ...any) driver.Row {
+	s.queries = append(s.queries, query)
+	return s.queryRow(query, args...)
+}
+
+// Query answers with the rows of query, or fails when it is not set
+func (s *stubConn) Query(ctx context.Context, query string, args ...any) (driver.Rows, error) {
+	s.queries = append(s.queries, query)
+	if s.query == nil {
+		return nil, fmt.Errorf("stubConn: queries not supported")
+	}
+	return &stubRows{rows: s.query(query, args...)}, nil
+}
+
+// stubRows is a driver.Rows scanning each row like a stubRow
+type stubRows struct {
+	driver.Rows
+	rows [][]any
+	next int
+}
+
+func (r *stubRows) Next() bool {
+	r.next++
+	return r.next <= len(r.rows)
+}
+
+func (r *stubRows) Scan(dest ...any) error { return stubRow{values: r.rows[r.next-1]}.Scan(dest...) }
+
+func (r *stubRows) Err() error { return nil }
+
+func (r *stubRows) Close() error { return nil }
+
+// PrepareBatch refuses writes through a batchWriter unless writes is set
+func (s *stubConn) PrepareBatch(ctx context.Context, query string, opts ...driver.PrepareBatchOption) (driver.Batch, error) {
+	if !s.writes {
+		return nil, fmt.Errorf("stubConn: writes not supported")
+	}
+	return &stubBatch{conn: s}, nil
+}
+
+// stubBatch adds its rows to the stubConn's appended rows when sent
+type stubBatch struct {
+	driver.Batch
+	conn *stubConn
+	rows [][]any
+}
+
+func (b *stubBatch) Append(v ...any) error {
+	b.rows = append(b.rows, v)
+	return nil
+}
+
+func (b *stubBatch) Abort() error { return nil }
+
+func (b *stubBatch) Send() error {
+	b.conn.appended = append(b.conn.appended, b.rows...)
+	return nil
+}
+
+// useStubConn replaces db with a stubConn for the duration of the test
+func useStubConn(t *testing.T, queryRow func(query string, args ...any) driver.Row) *stubConn {
+	t.Helper()
+	stub := &stubConn{queryRow: queryRow}
+	old := db
+	db = stub
+	t.Cleanup(func() { db = old })
+	return stub
+}
+
+// stubRow is a driver.Row scanning its values into the destinations in order
+type stubRow struct {
+	values []any
+	err    error
+}
+
+func (r stubRow) Err() error { return r.err }
+
+func (r stubRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	if len(dest) != len(r.values) {
+		return fmt.Errorf("stubRow: %d destinations for %d values", len(dest), len(r.values))
+	}
+	for i, value := range r.values {
+		reflect.ValueOf(dest[i]).Elem().Set(reflect.ValueOf(value))
+	}
+	return nil
+}
+
+func (r stubRow) ScanStruct(dest any) error { return fmt.Errorf("stubRow: ScanStruct not supported") }
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// What the new_tested/cumulative_tested columns count, set by TESTED_UNIT
+const (
+	testedUnitTests  = "tests"  // tests performed; one person may be counted several times
+	testedUnitPeople = "people" // distinct people tested
+)
+
+// positivityExpr is the day's confirmed cases per tested unit, NULL on days without tests.
+// With "tests" it is the test positivity rate, which may exceed 1 when cases are confirmed
+// without a test. With "people" it is the share of people tested who were positive, which
+// cannot: a day confirming more people than were tested mixes units, so it is NULL too.
+func positivityExpr() string {
+	if cfg.TestedUnit == testedUnitPeople {
+		return "if(new_tested > 0 AND new_confirmed <= new_tested, new_confirmed / new_tested, NULL)"
+	}
+	return "if(new_tested > 0, new_confirmed / new_tested, NULL)"
+}
+
+// normalizeTestedUnit validates TESTED_UNIT, defaulting to tests
+func normalizeTestedUnit(unit string) string {
+	if strings.EqualFold(unit, testedUnitPeople) {
+		return testedUnitPeople
+	}
+	return testedUnitTests
+}
+
+// positivityLabel describes the positivity value for the configured unit
+func positivityLabel() string {
+	if cfg.TestedUnit == testedUnitPeople {
+		return "share of people tested who were confirmed positive"
+	}
+	return "confirmed cases per test performed"
+}
+
+// labelTesting records the testing unit and the meaning of derived testing metrics
+func labelTesting(c *fiber.Ctx) {
+	addMeta(c, "tested_unit", cfg.TestedUnit)
+	addMeta(c, "positivity", positivityLabel())
+	c.Set("X-Tested-Unit", cfg.TestedUnit)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPositivityByTestedUnit(t *testing.T) {
+	defer func(old string) { cfg.TestedUnit = old }(cfg.TestedUnit)
+	filter := FilterRequest{LocationKey: "US", IncludePositivity: true}
+	for unit, want := range map[string]string{
+		testedUnitTests:  "if(new_tested > 0, new_confirmed / new_tested, NULL) AS positivity",
+		testedUnitPeople: "if(new_tested > 0 AND new_confirmed <= new_tested, new_confirmed / new_tested, NULL) AS positivity",
+	} {
+		cfg.TestedUnit = unit
+		q, err := newTimeSeriesQuery(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if query, _ := q.build(); !strings.Contains(query, want) {
+			t.Errorf("TESTED_UNIT=%s: query lacks %q:\n%s", unit, want, query)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// defaultQueryTimeouts is the query deadline of each route, sized to its cost; 0 disables the
+// deadline. Routes not listed use QUERY_TIMEOUT.
+var defaultQueryTimeouts = map[string]time.Duration{
+	"/api/location-keys":    10 * time.Second,
+	"/api/timeseries":       30 * time.Second,
+	"/api/excess":           30 * time.Second,
+	"/api/sparklines":       30 * time.Second,
+	"/api/movers":           30 * time.Second,
+	"/api/testing-coverage": 30 * time.Second,
+	"/api/aggregate":        time.Minute,
+	"/api/aggregate/series": time.Minute,
+	"/api/forecast":         10 * time.Second,
+	"/api/revisions":        time.Minute,
+	"/api/reporting-lag":    time.Minute,
+	"/api/weekly-trend":     time.Minute,
+	"/api/growth-factor":    time.Minute,
+	"/api/correlation":      2 * time.Minute,
+	"/api/groups":           time.Minute,
+	"/api/continents":       time.Minute,
+	"/api/rank":             10 * time.Second,
+	"/api/adjusted":         10 * time.Second,
+	"/api/milestones":       10 * time.Second,
+	"/api/integrity-check":  2 * time.Minute,
+	"/api/stale-locations":  30 * time.Second,
+	"/api/sla":              30 * time.Second,
+	"/api/admin/*":          2 * time.Minute,
+}
+
+// queryTimeouts applies QUERY_TIMEOUTS overrides ("path=duration" entries) to the defaults
+func queryTimeouts(overrides []string) map[string]time.Duration {
+	return routeDurations("QUERY_TIMEOUTS", defaultQueryTimeouts, overrides)
+}
+
+// routeQueryTimeout is the query deadline of path: its QUERY_TIMEOUTS entry or QUERY_TIMEOUT
+func routeQueryTimeout(path string) time.Duration {
+	if timeout, ok := routeDuration(cfg.QueryTimeouts, path); ok {
+		return timeout
+	}
+	return cfg.QueryTimeout
+}
+
+// limitQueryTime bounds the queries a handler runs with c.UserContext() by the route's
+// query timeout. A request whose queries failed because the deadline passed is answered
+// with QUERY_TIMEOUT_STATUS instead of the handler's 500.
+func limitQueryTime(c *fiber.Ctx) error {
+	// The matched route is not known yet inside group middleware; no /api route has parameters
+	timeout := routeQueryTimeout(c.Path())
+	if timeout <= 0 {
+		return c.Next()
+	}
+	ctx, cancel := context.WithTimeout(c.UserContext(), timeout)
+	defer cancel()
+	c.SetUserContext(ctx)
+
+	err := c.Next()
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) && c.Response().StatusCode() == http.StatusInternalServerError {
+		if cfg.QueryTimeoutStatus == http.StatusServiceUnavailable {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(cfg.QueryTimeoutRetryAfter.Seconds())))
+		}
+		return c.Status(cfg.QueryTimeoutStatus).JSON(fiber.Map{"error": "Query timed out after " + timeout.String()})
+	}
+	return err
+}
+
+// normalizeTimeoutStatus validates QUERY_TIMEOUT_STATUS, defaulting to 504
+func normalizeTimeoutStatus(status int) int {
+	if status == http.StatusServiceUnavailable {
+		return status
+	}
+	return http.StatusGatewayTimeout
+}
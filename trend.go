@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// WeeklyTrendData is one location's new_confirmed total for a week, compared with the week before
+type WeeklyTrendData struct {
+	LocationKey   string   `json:"location_key"`
+	Week          Date     `json:"week"` // Monday the week starts on
+	Days          uint64   `json:"days"` // days with a row inside the range; fewer than 7 for partial weeks
+	Total         int64    `json:"new_confirmed"`
+	PercentChange *float64 `json:"percent_change"` // null unless this and the prior week are both full and the prior total is positive
+}
+
+// getWeeklyTrend handles POST /api/weekly-trend, summing new_confirmed per location over
+// Monday-to-Sunday weeks of start_date..end_date and reporting the percentage change from
+// the preceding week. Days outside the range are not counted, so the first and last week
+// can be partial; their days tell them apart. The change is only reported between two
+// full weeks, since a partial week's total would read as a drop or a surge, and only
+// when the prior total is positive (a negative total after corrections has no meaningful
+// ratio).
+func getWeeklyTrend(c *fiber.Ctx) error {
+	var filter FilterRequest
+	if err := c.BodyParser(&filter); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid filter parameters"})
+	}
+	if _, _, err := parseDateRange("start_date", filter.StartDate, "end_date", filter.EndDate); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	keys, err := filter.locationKeys()
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	format, err := resolveDateFormat(c, filter.DateFormat)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	recordUsageFilter(c, keys, filter.StartDate, filter.EndDate)
+	clampDateRange(c, filter.StartDate, filter.EndDate)
+
+	conditions := []string{"date BETWEEN ? AND ?"}
+	args := []interface{}{filter.StartDate, filter.EndDate}
+	if len(keys) > 0 {
+		condition, arg := locationCondition(keys)
+		conditions = append(conditions, condition)
+		args = append(args, arg)
+	}
+	reads, readArgs, err := filter.readConditions(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	conditions = append(conditions, reads...)
+	args = append(args, readArgs...)
+
+	query := `
+	SELECT location_key,
+		   toMonday(date) AS week,
+		   uniqExact(date) AS days,
+		   sum(new_confirmed) AS total
+	FROM ` + readSource(conditions, filter.dedupe()) + `
+	GROUP BY location_key, week
+	ORDER BY location_key, week`
+
+	rows, err := db.Query(c.UserContext(), query, args...)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Query execution failed: " + err.Error()})
+	}
+	defer rows.Close()
+
+	data := []WeeklyTrendData{}
+	for rows.Next() {
+		w := WeeklyTrendData{Week: Date{format: format}}
+		if err := rows.Scan(&w.LocationKey, &w.Week.Time, &w.Days, &w.Total); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Row scan failed: " + err.Error()})
+		}
+		// Rows are ordered, so the previous row is the prior week when it is the same
+		// location and exactly seven days earlier (a week without rows breaks the chain)
+		if n := len(data); n > 0 && w.Days == 7 {
+			prev := data[n-1]
+			if prev.LocationKey == w.LocationKey && prev.Week.AddDate(0, 0, 7).Equal(w.Week.Time) && prev.Days == 7 && prev.Total > 0 {
+				change := round(float64(w.Total-prev.Total) / float64(prev.Total) * 100)
+				w.PercentChange = &change
+			}
+		}
+		data = append(data, w)
+	}
+
+	if err := rows.Err(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading rows"})
+	}
+
+	return respond(c, data)
+}
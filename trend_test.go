@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestWeeklyTrendPercentChange(t *testing.T) {
+	assumeTableNotEmpty(t)
+	week := func(month time.Month, day int) time.Time { return time.Date(2021, month, day, 0, 0, 0, 0, time.UTC) }
+	stub := useStubConn(t, func(query string, args ...any) driver.Row { return stubRow{err: errors.New("not stubbed")} })
+	stub.query = func(query string, args ...any) [][]any {
+		return [][]any{
+			{"FR", week(3, 1), uint64(7), int64(-5)},
+			{"FR", week(3, 8), uint64(7), int64(10)},
+			{"FR", week(3, 22), uint64(7), int64(20)},
+			{"US", week(3, 1), uint64(7), int64(100)},
+			{"US", week(3, 8), uint64(7), int64(150)},
+			{"US", week(3, 15), uint64(6), int64(120)},
+			{"US", week(3, 22), uint64(7), int64(100)},
+			{"US", week(3, 29), uint64(7), int64(0)},
+			{"US", week(4, 5), uint64(7), int64(50)},
+		}
+	}
+	app := fiber.New()
+	app.Post("/api/weekly-trend", negotiateSchema, getWeeklyTrend)
+	status, out := postV2(t, app, "/api/weekly-trend", `{"start_date": "2021-03-01", "end_date": "2021-04-11"}`)
+	if status != fiber.StatusOK {
+		t.Fatalf("status %d: %s", status, out["error"])
+	}
+	var data []struct {
+		LocationKey   string   `json:"location_key"`
+		Week          string   `json:"week"`
+		PercentChange *float64 `json:"percent_change"`
+	}
+	if err := json.Unmarshal(out["data"], &data); err != nil {
+		t.Fatal(err)
+	}
+	change := func(v float64) *float64 { return &v }
+	want := []*float64{
+		nil,          // FR first week
+		nil,          // prior total negative
+		nil,          // prior week missing
+		nil,          // US first week
+		change(50),   // two full weeks
+		nil,          // partial week
+		nil,          // prior week partial
+		change(-100), // drop to zero
+		nil,          // prior total zero
+	}
+	if len(data) != len(want) {
+		t.Fatalf("got %d weeks, want %d", len(data), len(want))
+	}
+	for i, w := range data {
+		if (w.PercentChange == nil) != (want[i] == nil) || (w.PercentChange != nil && *w.PercentChange != *want[i]) {
+			got, expected := "null", "null"
+			if w.PercentChange != nil {
+				got = jsonString(*w.PercentChange)
+			}
+			if want[i] != nil {
+				expected = jsonString(*want[i])
+			}
+			t.Errorf("%s %s: percent_change = %s, want %s", w.LocationKey, w.Week, got, expected)
+		}
+	}
+}
+
+// jsonString formats v as it would appear in a response
+func jsonString(v any) string {
+	raw, _ := json.Marshal(v)
+	return string(raw)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// usageRecord is one API request as stored in api_usage
+type usageRecord struct {
+	Timestamp    time.Time
+	Route        string
+	Method       string
+	LocationKeys []string
+	StartDate    string
+	EndDate      string
+	Consumer     string
+	Status       uint16
+	DurationMs   uint32
+	Rows         uint32
+	IP           string
+	Body         string
+	RequestID    string
+}
+
+// usageColumns are the api_usage columns in usageRecord order
+var usageColumns = []string{
+	"timestamp", "route", "method", "location_keys", "start_date", "end_date",
+	"consumer", "status", "duration_ms", "rows", "ip", "body", "request_id",
+}
+
+// usageRecords buffers records between flushes; when full, new records are dropped
+var usageRecords chan usageRecord
+
+// consumerID identifies the caller without storing its API key: a short hash of
+// X-API-Key, or "anon"
+func consumerID(c *fiber.Ctx) string {
+	key := c.Get("X-API-Key")
+	if key == "" {
+		return "anon"
+	}
+	return keyID(key)
+}
+
+// knownConsumerID is consumerID for keys listed in API_KEY_QUOTAS and "anon" for every
+// other caller, so it only takes as many values as there are configured keys
+func knownConsumerID(c *fiber.Ctx) string {
+	if consumer := consumerID(c); consumer != "anon" {
+		if _, ok := cfg.APIKeyQuotas[consumer]; ok {
+			return consumer
+		}
+	}
+	return "anon"
+}
+
+// keyID is the consumer id of an API key
+func keyID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "key:" + hex.EncodeToString(sum[:6])
+}
+
+// recordUsageFilter notes the normalized filter of the request for the usage log
+func recordUsageFilter(c *fiber.Ctx, keys []interface{}, startDate, endDate string) {
+	locations := make([]string, 0, len(keys))
+	for _, key := range keys {
+		locations = append(locations, key.(string))
+	}
+	sort.Strings(locations)
+	c.Locals("usage_locations", locations)
+	c.Locals("usage_start_date", startDate)
+	c.Locals("usage_end_date", endDate)
+}
+
+// usageLogger captures a usage record for every request after it completes.
+// Request bodies and client IPs are only kept when explicitly enabled.
+func usageLogger(c *fiber.Ctx) error {
+	start := time.Now()
+	err := c.Next()
+
+	record := usageRecord{
+		Timestamp:  start.UTC(),
+		Route:      c.Route().Path,
+		Method:     c.Method(),
+		Consumer:   consumerID(c),
+		Status:     uint16(c.Response().StatusCode()),
+		DurationMs: uint32(time.Since(start).Milliseconds()),
+		RequestID:  requestIDOf(c),
+	}
+	record.LocationKeys, _ = c.Locals("usage_locations").([]string)
+	if record.LocationKeys == nil {
+		record.LocationKeys = []string{}
+	}
+	record.StartDate, _ = c.Locals("usage_start_date").(string)
+	record.EndDate, _ = c.Locals("usage_end_date").(string)
+	if n, ok := c.Locals("rows_returned").(int); ok {
+		record.Rows = uint32(n)
+	}
+	if cfg.UsageStoreIPs {
+		record.IP = c.IP()
+	}
+	if cfg.UsageStoreBodies {
+		record.Body = string(c.Body())
+	}
+
+	select {
+	case usageRecords <- record:
+	default:
+		usageRecordsDropped.Inc()
+	}
+	return err
+}
+
+// startUsageFlusher writes buffered usage records to api_usage every USAGE_FLUSH_INTERVAL,
+// flushing what is left when ctx is done
+func startUsageFlusher(ctx context.Context) {
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		ticker := time.NewTicker(cfg.UsageFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				// ctx is already cancelled; give the final flush its own deadline
+				flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				flushUsage(flushCtx)
+				cancel()
+				return
+			case <-ticker.C:
+				flushUsage(ctx)
+			}
+		}
+	}()
+}
+
+// flushUsage drains the buffer into a single batch
+func flushUsage(ctx context.Context) {
+	writer := newBatchWriter("api_usage", usageColumns, cap(usageRecords))
+	for {
+		select {
+		case r := <-usageRecords:
+			if err := writer.Add(ctx, r.Timestamp, r.Route, r.Method, r.LocationKeys, r.StartDate, r.EndDate,
+				r.Consumer, r.Status, r.DurationMs, r.Rows, r.IP, r.Body, r.RequestID); err != nil {
+				log.Printf("failed to write usage records: %v", err)
+			}
+		default:
+			if err := writer.Flush(ctx); err != nil {
+				log.Printf("failed to write usage records: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// usageCount is one row of a usage aggregation
+type usageCount struct {
+	Key      string `json:"key"`
+	Requests uint64 `json:"requests"`
+}
+
+// getUsage handles GET /api/admin/usage, summarizing the last ?days=30 of usage:
+// the most requested locations, the busiest consumers and requests per day
+func getUsage(c *fiber.Ctx) error {
+	days := c.QueryInt("days", 30)
+	if days <= 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "days must be positive"})
+	}
+
+	queries := map[string]string{
+		"top_locations": `
+	SELECT arrayJoin(location_keys) AS key, count() AS requests
+	FROM api_usage WHERE timestamp >= now() - toIntervalDay(?)
+	GROUP BY key ORDER BY requests DESC LIMIT 20`,
+		"top_consumers": `
+	SELECT consumer AS key, count() AS requests
+	FROM api_usage WHERE timestamp >= now() - toIntervalDay(?)
+	GROUP BY key ORDER BY requests DESC LIMIT 20`,
+		"requests_per_day": `
+	SELECT toString(toDate(timestamp)) AS key, count() AS requests
+	FROM api_usage WHERE timestamp >= now() - toIntervalDay(?)
+	GROUP BY key ORDER BY key`,
+	}
+
+	result := fiber.Map{}
+	for name, query := range queries {
+		rows, err := db.Query(c.UserContext(), query, days)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Query execution failed: " + err.Error()})
+		}
+		counts := []usageCount{}
+		for rows.Next() {
+			var uc usageCount
+			if err := rows.Scan(&uc.Key, &uc.Requests); err != nil {
+				rows.Close()
+				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Row scan failed: " + err.Error()})
+			}
+			counts = append(counts, uc)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading rows"})
+		}
+		result[name] = counts
+	}
+	return sendJSON(c, result)
+}
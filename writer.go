@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// batchWriter buffers rows for a table and inserts them with one batch per size rows
+type batchWriter struct {
+	table   string
+	columns []string
+	size    int
+	rows    [][]interface{}
+	written int
+}
+
+// newBatchWriter creates a writer inserting the given columns of table
+func newBatchWriter(table string, columns []string, size int) *batchWriter {
+	if size <= 0 {
+		size = 1
+	}
+	return &batchWriter{table: table, columns: columns, size: size}
+}
+
+// Add queues one row, flushing when the batch is full
+func (w *batchWriter) Add(ctx context.Context, values ...interface{}) error {
+	if len(values) != len(w.columns) {
+		return fmt.Errorf("expected %d values, got %d", len(w.columns), len(values))
+	}
+	w.rows = append(w.rows, values)
+	if len(w.rows) >= w.size {
+		return w.Flush(ctx)
+	}
+	return nil
+}
+
+// Flush sends all queued rows to ClickHouse
+func (w *batchWriter) Flush(ctx context.Context) error {
+	if len(w.rows) == 0 {
+		return nil
+	}
+	batch, err := db.PrepareBatch(ctx, fmt.Sprintf("INSERT INTO %s (%s)", w.table, join(w.columns, ", ")))
+	if err != nil {
+		return err
+	}
+	for _, row := range w.rows {
+		if err := batch.Append(row...); err != nil {
+			_ = batch.Abort()
+			return err
+		}
+	}
+	if err := batch.Send(); err != nil {
+		return err
+	}
+	w.written += len(w.rows)
+	w.rows = w.rows[:0]
+	return nil
+}
+
+// Written returns the number of rows successfully sent so far
+func (w *batchWriter) Written() int {
+	return w.written
+}
+
+// newTimeSeriesWriter returns a batch writer for covid19 rows
+func newTimeSeriesWriter() *batchWriter {
+	return newBatchWriter("covid19", append([]string{"location_key", "date"}, metricColumns...), cfg.IngestBatchSize)
+}
+
+// addTimeSeries queues ts on a writer created by newTimeSeriesWriter
+func (w *batchWriter) addTimeSeries(ctx context.Context, ts TimeSeriesData) error {
+	return w.Add(ctx,
+		ts.LocationKey,
+		ts.Date.Time,
+		valueOrZero(ts.NewConfirmed),
+		valueOrZero(ts.NewDeceased),
+		valueOrZero(ts.NewRecovered),
+		valueOrZero(ts.NewTested),
+		valueOrZero(ts.CumulativeConfirmed),
+		valueOrZero(ts.CumulativeDeceased),
+		valueOrZero(ts.CumulativeRecovered),
+		valueOrZero(ts.CumulativeTested),
+	)
+}
+
+// valueOrZero dereferences an optional metric, treating missing values as zero
+func valueOrZero(v *int32) int32 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}